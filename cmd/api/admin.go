@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SAURABH200301/Social/internal/store"
+	"github.com/google/uuid"
+)
+
+type SuspendUserPayload struct {
+	Until  time.Time `json:"until" validate:"required"`
+	Reason string    `json:"reason" validate:"required,max=500"`
+}
+
+type BanUserPayload struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// Search Users Handler
+//
+//	@Summary		Search users
+//	@Description	Lists accounts in any state, newest first, filtered by username or email, status and role.
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			search	query		string	false	"Part of the username or email"
+//	@Param			status	query		string	false	"Account status"	Enums(active, inactive, suspended, banned)
+//	@Param			role	query		string	false	"Role name"
+//	@Param			limit	query		int		false	"Number of users to return"	default(20)	minimum(1)	maximum(100)
+//	@Param			offset	query		int		false	"Number of users to skip"	default(0)	minimum(0)
+//	@Success		200		{array}		store.Users
+//	@Failure		400		{object}	errorResponse
+//	@Failure		403		{object}	errorResponse
+//	@Failure		500		{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/users [get]
+func (app *application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	uq := store.UserSearchQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+	query, err := uq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(query); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	users, err := app.store.Users.Search(r.Context(), query)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Suspend User Handler
+//
+//	@Summary		Suspend a user
+//	@Description	Blocks a user until the given time and ends all of their sessions.
+//	@Tags			Admin
+//	@Accept			json
+//	@Param			userID	path	int					true	"User ID"
+//	@Param			payload	body	SuspendUserPayload	true	"End of the suspension and reason"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		403	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/users/{userID}/suspend [post]
+func (app *application) suspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	var payload SuspendUserPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !payload.Until.After(time.Now()) {
+		app.badRequestResponse(w, r, fmt.Errorf("until must be in the future"))
+		return
+	}
+
+	target, ok := app.loadManagedUser(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	if err := app.store.Users.Suspend(ctx, target.ID, payload.Until, payload.Reason); err != nil {
+		app.managedUserError(w, r, target.ID, err)
+		return
+	}
+	app.invalidateUserCache(ctx, target.ID)
+	app.logger.Infow("user suspended", "userID", target.ID, "by", getUserFromCtx(r).ID, "until", payload.Until)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Ban User Handler
+//
+//	@Summary		Ban a user
+//	@Description	Blocks a user permanently and ends all of their sessions.
+//	@Tags			Admin
+//	@Accept			json
+//	@Param			userID	path	int				true	"User ID"
+//	@Param			payload	body	BanUserPayload	true	"Reason"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		403	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/users/{userID}/ban [post]
+func (app *application) banUserHandler(w http.ResponseWriter, r *http.Request) {
+	var payload BanUserPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	target, ok := app.loadManagedUser(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	if err := app.store.Users.Ban(ctx, target.ID, payload.Reason); err != nil {
+		app.managedUserError(w, r, target.ID, err)
+		return
+	}
+	app.invalidateUserCache(ctx, target.ID)
+	app.logger.Infow("user banned", "userID", target.ID, "by", getUserFromCtx(r).ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Reactivate User Handler
+//
+//	@Summary		Reactivate a user
+//	@Description	Lifts a suspension or a ban. Lifting a ban needs the permission to ban.
+//	@Tags			Admin
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		403	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/users/{userID}/reactivate [post]
+func (app *application) reactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	target, ok := app.loadManagedUser(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	if target.BannedAt != nil {
+		allowed, err := app.hasPermission(ctx, getUserFromCtx(r), store.PermissionUserBan)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			app.forbiddenResponse(w, r)
+			return
+		}
+	}
+
+	if err := app.store.Users.Reactivate(ctx, target.ID); err != nil {
+		app.managedUserError(w, r, target.ID, err)
+		return
+	}
+	app.invalidateUserCache(ctx, target.ID)
+	app.logger.Infow("user reactivated", "userID", target.ID, "by", getUserFromCtx(r).ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Force Password Reset Handler
+//
+//	@Summary		Force a password reset
+//	@Description	Invalidates the password of a user, ends all of their sessions and emails them a reset link.
+//	@Tags			Admin
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		202
+//	@Failure		400	{object}	errorResponse
+//	@Failure		403	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/users/{userID}/password-reset [post]
+func (app *application) forcePasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	target, ok := app.loadManagedUser(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	plainToken := uuid.New().String()
+	resetEmail, err := app.passwordResetEmail(target, plainToken)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	err = app.store.Users.ForcePasswordReset(ctx, target.ID, hashToken(plainToken), app.config.mail.passwordResetExp, resetEmail)
+	if err != nil {
+		app.managedUserError(w, r, target.ID, err)
+		return
+	}
+	app.invalidateUserCache(ctx, target.ID)
+	app.logger.Infow("password reset forced", "userID", target.ID, "by", getUserFromCtx(r).ID)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// loadManagedUser resolves the {userID} an admin action targets. Nobody can
+// act on their own account or on an account whose role ranks as high as
+// their own.
+func (app *application) loadManagedUser(w http.ResponseWriter, r *http.Request) (*store.Users, bool) {
+	userID, err := getUserIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	actor := getUserFromCtx(r)
+	if userID == actor.ID {
+		app.badRequestResponse(w, r, fmt.Errorf("you cannot manage your own account"))
+		return nil, false
+	}
+
+	target, err := app.store.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		app.managedUserError(w, r, userID, err)
+		return nil, false
+	}
+	if target.Role.Level >= actor.Role.Level {
+		app.forbiddenResponse(w, r)
+		return nil, false
+	}
+	return target, true
+}
+
+func (app *application) managedUserError(w http.ResponseWriter, r *http.Request, userID int64, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		app.notFoundResponse(w, r, fmt.Errorf("user with ID %d not found", userID))
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
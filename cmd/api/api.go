@@ -6,9 +6,11 @@ import (
 	"expvar"
 	"fmt"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -23,6 +25,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 
 	httpSwagger "github.com/swaggo/http-swagger"
 )
@@ -33,8 +36,12 @@ type application struct {
 	cacheStorage  cache.Storage
 	logger        *zap.SugaredLogger
 	mailer        mailer.Client
+	mailTemplates *mailer.Templates
 	Authonticator auth.Authenicator
-	rateLimiter   ratelimiter.Limiter
+	rateLimiters  map[string]ratelimiter.Limiter
+	roles         *roleCache
+	// coalesces concurrent cache fills of the same user
+	userFills singleflight.Group
 }
 type dbConfig struct {
 	addr         string
@@ -51,7 +58,12 @@ type config struct {
 	frontendURL string
 	auth        authConfig
 	redisCfg    redisConfig
+	cache       cacheConfig
 	rateLimiter ratelimiter.Config
+	// trustedProxies are the reverse proxies whose X-Forwarded-For and
+	// X-Real-IP headers are believed. Empty means the API is reached
+	// directly and clients are identified by the socket peer address.
+	trustedProxies []netip.Prefix
 }
 
 type redisConfig struct {
@@ -61,15 +73,47 @@ type redisConfig struct {
 	enabled bool
 }
 
+// cacheConfig sizes the in-process cache used when Redis is disabled.
+type cacheConfig struct {
+	maxEntries int
+}
+
 type authConfig struct {
-	basic basicConfig
-	token tokenConfig
+	basic   basicConfig
+	token   tokenConfig
+	mfa     mfaConfig
+	lockout lockoutConfig
+	// how long role definitions are cached before being reloaded
+	roleCacheTTL time.Duration
+}
+
+// lockoutConfig throttles password guessing. Every key, an account or a
+// client IP, gets freeAttempts failures before each further attempt has to
+// wait baseDelay, doubling up to maxDelay. Reaching maxFailures (accounts) or
+// maxIPFailures (IPs) locks the key for duration.
+type lockoutConfig struct {
+	freeAttempts  int
+	baseDelay     time.Duration
+	maxDelay      time.Duration
+	maxFailures   int
+	maxIPFailures int
+	duration      time.Duration
+	// failures are forgotten after this long without a new one
+	window    time.Duration
+	unlockExp time.Duration
+}
+
+type mfaConfig struct {
+	issuer       string
+	challengeExp time.Duration
 }
 
 type tokenConfig struct {
-	secret string
-	exp    time.Duration
-	iss    string
+	signingKeyFile       string
+	verificationKeyFiles []string
+	exp                  time.Duration
+	refreshExp           time.Duration
+	iss                  string
 }
 
 type basicConfig struct {
@@ -79,8 +123,48 @@ type basicConfig struct {
 
 type mailConfig struct {
 	invitationExp time.Duration
-	fromEmail     string
-	sendGrid      sendGridConfig
+	// how long after an activation email another one may be requested
+	activationResendCooldown time.Duration
+	passwordResetExp         time.Duration
+	fromEmail                string
+	// provider is one of the mailProvider constants
+	provider string
+	sendGrid sendGridConfig
+	smtp     mailer.SMTPConfig
+	sweeper  sweeperConfig
+	outbox   outboxConfig
+	// signs unsubscribe links
+	unsubscribeSecret string
+	// how long an unsubscribe link works after its email was sent
+	unsubscribeLinkTTL time.Duration
+	// publicAPIURL is where mail clients reach the API for one-click
+	// unsubscribes, which RFC 8058 requires to be HTTPS
+	publicAPIURL string
+}
+
+// outboxConfig drives the email delivery workers. A failed email is retried
+// after baseBackoff, doubling up to maxBackoff, and dead-lettered after
+// maxAttempts.
+type outboxConfig struct {
+	workers      int
+	pollInterval time.Duration
+	// how long a worker may hold an email before another one takes it over
+	lease       time.Duration
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+}
+
+const (
+	mailProviderSendGrid = "sendgrid"
+	mailProviderSMTP     = "smtp"
+)
+
+type sweeperConfig struct {
+	interval time.Duration
+	// accounts never activated are deleted this long after registration,
+	// zero keeps them forever
+	unactivatedGrace time.Duration
 }
 type sendGridConfig struct {
 	apiKey string
@@ -91,26 +175,27 @@ func (app *application) mount() http.Handler {
 
 	//GLOBAL MIDDLEWARE
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(app.realIP)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Logger)
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{env.GetString("CORS_ALLOWED_ORIGIN", "http://localhost:3000")},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
 
-	r.Use(app.RateLimiterMiddleware)
-
 	r.Use(middleware.Timeout(60 * time.Second))
 
+	r.With(app.rateLimit(ratelimiter.DefaultPolicy)).Get("/.well-known/jwks.json", app.jwksHandler)
+
 	r.Route("/v1", func(r chi.Router) {
+		// health checks are never rate limited
 		r.Get("/health", app.healthCheckHandler)
-		r.With(app.BasicAuthMiddleware()).Get("/debug/vars", expvar.Handler().ServeHTTP)
+		r.With(app.rateLimit(ratelimiter.DefaultPolicy), app.BasicAuthMiddleware()).Get("/debug/vars", expvar.Handler().ServeHTTP)
 
 		host := "http://" + app.config.apiURL
 		if host == "" {
@@ -118,7 +203,7 @@ func (app *application) mount() http.Handler {
 				host = "http://" + host
 			}
 		}
-		r.Get("/swagger/doc.json", func(w http.ResponseWriter, r *http.Request) {
+		r.With(app.rateLimit(ratelimiter.DefaultPolicy)).Get("/swagger/doc.json", func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "application/json")
 			swaggerFile, err := os.ReadFile("../docs/swagger.yaml")
 			if err != nil {
@@ -129,46 +214,159 @@ func (app *application) mount() http.Handler {
 			w.Write(swaggerFile)
 		})
 		docsURL := fmt.Sprintf("%s/v1/swagger/doc.json", host)
-		r.Get("/swagger/*", httpSwagger.Handler(
+		r.With(app.rateLimit(ratelimiter.DefaultPolicy)).Get("/swagger/*", httpSwagger.Handler(
 			httpSwagger.URL(docsURL),
-		))
+		).ServeHTTP)
 
 		//v1/posts endpoints
 		r.Route("/posts", func(r chi.Router) {
+			r.Use(app.rateLimit(rateLimitPolicyClient))
 			r.Use(app.AuthTokenMiddleware)
-			r.Post("/", app.createPostHandler)
+			r.Use(app.rateLimit(ratelimiter.DefaultPolicy))
+			r.With(app.requireScope(ScopePostsWrite)).Post("/", app.createPostHandler)
 
 			r.Route("/{postID}", func(r chi.Router) {
 				//CONSUME MIDDLEWARE
 				r.Use(app.postContextMiddleware)
 
 				//INTERNAL ROUTES
-				r.Get("/", app.getPostHandler)
-				r.Patch("/", app.checkPostOwnershipMiddleware("moderator", app.updatePostHandler))
-				r.Delete("/", app.checkPostOwnershipMiddleware("moderator", app.deletePostHandler))
+				r.With(app.requireScope(ScopePostsRead)).Get("/", app.getPostHandler)
+				r.With(app.requireScope(ScopePostsWrite)).Patch("/", app.checkPostOwnershipMiddleware(store.PermissionPostUpdateAny, app.updatePostHandler))
+				r.With(app.requireScope(ScopePostsWrite)).Delete("/", app.checkPostOwnershipMiddleware(store.PermissionPostDeleteAny, app.deletePostHandler))
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.requireScope(ScopeReactionsWrite))
+					r.Put("/reactions/{type}", app.addReactionHandler)
+					r.Delete("/reactions/{type}", app.removeReactionHandler)
+				})
+
+				r.Route("/comments", func(r chi.Router) {
+					r.With(app.requireScope(ScopePostsRead)).Get("/", app.getPostCommentsHandler)
+					r.With(app.requireScope(ScopeCommentsWrite)).Post("/", app.createCommentHandler)
+
+					r.Route("/{commentID}", func(r chi.Router) {
+						r.Use(app.commentContextMiddleware)
+
+						r.With(app.requireScope(ScopePostsRead)).Get("/replies", app.getCommentRepliesHandler)
+						r.With(app.requireScope(ScopeCommentsWrite)).Patch("/", app.checkCommentOwnershipMiddleware(store.PermissionCommentUpdateAny, app.updateCommentHandler))
+						r.With(app.requireScope(ScopeCommentsWrite)).Delete("/", app.checkCommentOwnershipMiddleware(store.PermissionCommentDeleteAny, app.deleteCommentHandler))
+					})
+				})
 			})
 		})
 		r.Route("/users", func(r chi.Router) {
-
-			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(app.rateLimit(rateLimitPolicyAuth))
+				r.Put("/activate/{token}", app.activateUserHandler)
+				r.Post("/activate/resend", app.resendActivationHandler)
+			})
 
 			r.Route("/{userID}", func(r chi.Router) {
+				r.Use(app.rateLimit(rateLimitPolicyClient))
 				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.rateLimit(ratelimiter.DefaultPolicy))
 				//INTERNAL ROUTES
-				r.Get("/", app.getUserHandler)
-				// r.Put("/follow", app.followUserHandler)
-				// r.Put("/unfollow", app.unfollowUserHandler)
+				r.With(app.requireScope(ScopeUsersRead)).Get("/", app.getUserHandler)
+				r.With(app.requireScope(ScopeUsersWrite)).Put("/follow", app.followUserHandler)
+				r.With(app.requireScope(ScopeUsersWrite)).Put("/unfollow", app.unfollowUserHandler)
+				r.With(app.requireScope(ScopeUsersRead)).Get("/followers", app.getUserFollowersHandler)
+				r.With(app.requireScope(ScopeUsersRead)).Get("/following", app.getUserFollowingHandler)
+				r.With(app.requireSession, app.requirePermission(store.PermissionUserAuthEventsRead)).Get("/auth-events", app.getUserAuthEventsHandler)
 			})
 
 			r.Group(func(r chi.Router) {
+				r.Use(app.rateLimit(rateLimitPolicyClient))
 				r.Use(app.AuthTokenMiddleware)
-				r.Get("/feed", app.getUserFeedHandler)
+				r.Use(app.rateLimit(rateLimitPolicyFeed))
+				r.With(app.requireScope(ScopeFeedRead)).Get("/feed", app.getUserFeedHandler)
 			})
 
 		})
+		//v1/notifications endpoints
+		r.Route("/notifications", func(r chi.Router) {
+			// unsubscribe links are followed without signing in, the signed
+			// token identifies the user
+			r.With(app.rateLimit(rateLimitPolicyAuth)).Post("/unsubscribe/{token}", app.unsubscribeHandler)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.rateLimit(rateLimitPolicyClient))
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.rateLimit(ratelimiter.DefaultPolicy))
+				r.With(app.requireScope(ScopeUsersRead)).Get("/", app.getNotificationSettingsHandler)
+				r.With(app.requireScope(ScopeUsersWrite)).Patch("/", app.updateNotificationSettingsHandler)
+				r.With(app.requireScope(ScopeUsersWrite)).Patch("/language", app.updateLanguageHandler)
+			})
+		})
 		r.Route("/authenticate", func(r chi.Router) {
-			r.Post("/user", app.registerUserHandler)
-			r.Post("/token", app.createTokenHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(app.rateLimit(rateLimitPolicyAuth))
+				r.Post("/user", app.registerUserHandler)
+				r.Post("/token", app.createTokenHandler)
+				r.Post("/token/mfa", app.completeMFAChallengeHandler)
+				r.Post("/refresh", app.refreshTokenHandler)
+				r.Post("/logout", app.logoutHandler)
+				r.Post("/password/forgot", app.forgotPasswordHandler)
+				r.Post("/password/reset", app.resetPasswordHandler)
+				r.Post("/unlock", app.unlockAccountHandler)
+			})
+
+			r.Route("/mfa/totp", func(r chi.Router) {
+				r.Use(app.rateLimit(rateLimitPolicyClient))
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.rateLimit(rateLimitPolicyAuth))
+				r.Use(app.requireSession)
+				r.Post("/", app.enrollTOTPHandler)
+				r.Post("/confirm", app.confirmTOTPHandler)
+				r.Post("/disable", app.disableTOTPHandler)
+			})
+		})
+
+		//v1/tokens endpoints, personal access tokens can only be managed from a session
+		r.Route("/tokens", func(r chi.Router) {
+			r.Use(app.rateLimit(rateLimitPolicyClient))
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.rateLimit(ratelimiter.DefaultPolicy))
+			r.Use(app.requireSession)
+			r.Post("/", app.createAccessTokenHandler)
+			r.Get("/", app.listAccessTokensHandler)
+			r.Delete("/{tokenID}", app.revokeAccessTokenHandler)
+		})
+
+		//v1/admin endpoints
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(app.rateLimit(rateLimitPolicyClient))
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.rateLimit(ratelimiter.DefaultPolicy))
+			r.Use(app.requireSession)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.requirePermission(store.PermissionRoleManage))
+				r.Get("/permissions", app.listPermissionsHandler)
+				r.Get("/roles", app.listRolesHandler)
+				r.Post("/roles", app.createRoleHandler)
+				r.Put("/roles/{roleID}/permissions", app.setRolePermissionsHandler)
+			})
+
+			r.Route("/emails", func(r chi.Router) {
+				r.Use(app.requirePermission(store.PermissionMailOutboxManage))
+				r.Get("/", app.listEmailsHandler)
+				r.Get("/{emailID}", app.getEmailHandler)
+				r.Post("/{emailID}/retry", app.retryEmailHandler)
+			})
+
+			r.With(app.requirePermission(store.PermissionMailPreview)).Get("/mail/preview/{template}", app.previewEmailHandler)
+
+			r.Route("/users", func(r chi.Router) {
+				r.With(app.requirePermission(store.PermissionUserSearch)).Get("/", app.searchUsersHandler)
+
+				r.Route("/{userID}", func(r chi.Router) {
+					r.With(app.requirePermission(store.PermissionUserSuspend)).Post("/suspend", app.suspendUserHandler)
+					r.With(app.requirePermission(store.PermissionUserSuspend)).Post("/reactivate", app.reactivateUserHandler)
+					r.With(app.requirePermission(store.PermissionUserBan)).Post("/ban", app.banUserHandler)
+					r.With(app.requirePermission(store.PermissionUserPasswordReset)).Post("/password-reset", app.forcePasswordResetHandler)
+					r.With(app.requirePermission(store.PermissionUserRoleUpdate)).Put("/role", app.updateUserRoleHandler)
+				})
+			})
 		})
 	})
 
@@ -191,6 +389,19 @@ func (app *application) run(mux http.Handler) error {
 
 	shutdown := make(chan error)
 
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+	workers.Add(2)
+	go func() {
+		defer workers.Done()
+		app.runInvitationSweeper(workersCtx)
+	}()
+	go func() {
+		defer workers.Done()
+		app.runEmailWorkers(workersCtx)
+	}()
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -214,5 +425,24 @@ func (app *application) run(mux http.Handler) error {
 		return err
 	}
 	app.logger.Infow("Stopped server", "addr", app.config.addr, "env", app.config.env)
+
+	// workers finish the email they are sending before they return
+	stopWorkers()
+	stopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		app.logger.Infow("Stopped background workers")
+	case <-time.After(workerShutdownTimeout):
+		app.logger.Warnw("background workers did not stop in time", "timeout", workerShutdownTimeout)
+	}
 	return nil
 }
+
+// workerShutdownTimeout is how long shutdown waits for the email workers and
+// the sweeper. It covers a send that just started, bounded by the timeouts
+// of the mailers.
+const workerShutdownTimeout = 30 * time.Second
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -17,6 +21,9 @@ type RegisterUserPayload struct {
 	Username string `json:"username" validate:"required,min=3,max=30"`
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=8"`
+	// Language picks the translation of the emails the user gets, en when
+	// left out
+	Language string `json:"language" validate:"omitempty,max=35,bcp47_language_tag"`
 }
 
 // Register User Handler
@@ -45,6 +52,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	user := store.Users{
 		Username: payload.Username,
 		Email:    payload.Email,
+		Language: payload.Language,
 		Role: store.Role{
 			Name: "user",
 		},
@@ -58,17 +66,28 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	ctx := r.Context()
 
 	plainToken := uuid.New().String()
+	hashedToken := hashToken(plainToken)
 
-	hash := sha256.Sum256([]byte(plainToken))
-	hashedToken := hex.EncodeToString(hash[:])
-
-	err := app.store.Users.CreateAndInvite(ctx, &user, hashedToken, app.config.mail.invitationExp)
+	invitation, err := app.activationEmail(&user, plainToken)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	// the invitation email is queued with the account, so it is sent exactly
+	// when the account exists
+	err = app.store.Users.CreateAndInvite(ctx, &user, hashedToken, app.config.mail.invitationExp, invitation)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	isProdEnv := app.config.env == "production"
+	if err := app.jsonResponse(w, http.StatusCreated, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) activationEmail(user *store.Users, plainToken string) (*store.OutboxEmail, error) {
 	activationUrl := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken)
 	vars := struct {
 		Username      string
@@ -78,29 +97,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		ActivationURL: activationUrl,
 	}
 
-	err = app.mailer.Send(
-		mailer.UserWelcomeTemplate,
-		user.Username,
-		user.Email,
-		vars,
-		!isProdEnv,
-	)
-	if err != nil {
-		app.logger.Errorw("failed to send welcome email", "error", err, "email", user.Email)
-
-		err := app.store.Users.DeleteByID(ctx, user.ID)
-		if err != nil {
-			app.logger.Errorw("failed to delete user after email failure", "error", err, "userID", user.ID)
-		}
-
-		app.internalServerError(w, r, err)
-		return
-	}
-
-	if err := app.jsonResponse(w, http.StatusCreated, nil); err != nil {
-		app.internalServerError(w, r, err)
-		return
-	}
+	return app.newEmail(mailer.UserWelcomeTemplate, user, vars)
 }
 
 type CreateUserTokenPayload struct {
@@ -108,16 +105,26 @@ type CreateUserTokenPayload struct {
 	Password string `json:"password" validate:"required,min=3,max=72"`
 }
 
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
 // Create Token Handler Handler
 //
 //	@Summary		Creats a token
-//	@Description	Creates a token for user
+//	@Description	Creates a short-lived access token and a refresh token for the user. Accounts with two-factor authentication get a challenge instead, to be completed at /authenticate/token/mfa.
 //	@Tags			Authentication
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		CreateUserTokenPayload	true	"User credentials"
-//	@Success		201		{object}	string					"token"
+//	@Success		201		{object}	TokenResponse			"tokens"
+//	@Success		202		{object}	MFAChallengeResponse	"second factor required"
 //	@Failure		400		{object}	error
+//	@Failure		403		{object}	error					"account suspended"
+//	@Failure		429		{object}	error					"too many failed logins"
 //	@Failure		500		{object}	error
 //	@Router			/authenticate/token [post]
 func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -132,19 +139,200 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	ctx := r.Context()
+	ipKey := store.IPThrottleKey(clientIP(r))
+	ipThrottle, ok := app.reserveLoginAttempt(w, r, ipKey)
+	if !ok {
+		return
+	}
+
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// an unknown email is throttled, checked and answered exactly like a
+	// wrong password, so logins do not reveal which emails have accounts
+	accountKey := store.EmailThrottleKey(payload.Email)
+	if user != nil {
+		accountKey = store.AccountThrottleKey(user.ID)
+	}
+	accountThrottle, ok := app.reserveLoginAttempt(w, r, accountKey)
+	if !ok {
+		app.releaseLoginAttempts(ctx, ipKey)
+		return
+	}
+
+	if user == nil {
+		store.CompareDummyPassword(payload.Password)
+	}
+	if user == nil || user.Password.Compare(payload.Password) != nil {
+		if err := app.recordLoginFailure(r, ipThrottle, accountThrottle, user); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		app.unauthorizationErrorResponse(w, r, errors.New("invalid email or password"))
+		return
+	}
+	app.releaseLoginAttempts(ctx, ipKey, accountKey)
+
+	if user.Suspended(time.Now()) {
+		app.accountSuspendedResponse(w, r, user)
+		return
+	}
+
+	totp, err := app.store.MFA.GetTOTP(ctx, user.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+	// earlier failures are kept until the second factor passes too, so
+	// guessing codes stays throttled
+	if totp.Enabled() {
+		challenge, err := app.createMFAChallenge(ctx, user.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if err := app.jsonResponse(w, http.StatusAccepted, challenge); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	tokens, err := app.startSession(ctx, user.ID)
 	if err != nil {
-		app.notFoundResponse(w, r, err)
+		app.internalServerError(w, r, err)
 		return
 	}
+	app.clearLoginFailures(ctx, user.ID)
+
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
 
-	if err := user.Password.Compare(payload.Password); err != nil {
+// Refresh Token Handler
+//
+//	@Summary		Refresh an access token
+//	@Description	Exchanges a refresh token for a new access token and a new refresh token. Each refresh token can be used only once; replaying a used one revokes every token of that login session.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		RefreshTokenPayload	true	"Refresh token"
+//	@Success		200		{object}	TokenResponse		"tokens"
+//	@Failure		400		{object}	errorResponse
+//	@Failure		401		{object}	errorResponse
+//	@Failure		500		{object}	errorResponse
+//	@Router			/authenticate/refresh [post]
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	next, plainRefreshToken, err := app.newRefreshToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	err = app.store.RefreshTokens.Rotate(ctx, hashToken(payload.RefreshToken), next)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRefreshTokenReused):
+			app.logger.Warnw("refresh token reuse detected, session revoked", "ip", r.RemoteAddr)
+			app.unauthorizationErrorResponse(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.unauthorizationErrorResponse(w, r, fmt.Errorf("invalid or expired refresh token"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the account may have been deactivated or suspended since the session started
+	user, err := app.store.Users.GetByID(ctx, next.UserID)
+	if err != nil {
 		app.unauthorizationErrorResponse(w, r, err)
 		return
 	}
+	if user.Suspended(time.Now()) {
+		app.accountSuspendedResponse(w, r, user)
+		return
+	}
+
+	tokens, err := app.issueTokens(next.UserID, plainRefreshToken)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Logout Handler
+//
+//	@Summary		Log out
+//	@Description	Revokes the refresh token and every token rotated from the same login.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Param			payload	body	RefreshTokenPayload	true	"Refresh token"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Router			/authenticate/logout [post]
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.RefreshTokens.RevokeFamily(r.Context(), hashToken(payload.RefreshToken)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
+// startSession opens a new refresh token family for userID and returns the
+// first token pair of it.
+func (app *application) startSession(ctx context.Context, userID int64) (*TokenResponse, error) {
+	refreshToken, plainRefreshToken, err := app.newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	refreshToken.UserID = userID
+	refreshToken.FamilyID = uuid.New().String()
+	if err := app.store.RefreshTokens.Create(ctx, refreshToken); err != nil {
+		return nil, err
+	}
+	return app.issueTokens(userID, plainRefreshToken)
+}
+
+// issueTokens signs a new access token for userID and pairs it with an
+// already persisted refresh token.
+func (app *application) issueTokens(userID int64, plainRefreshToken string) (*TokenResponse, error) {
 	claims := jwt.MapClaims{
-		"sub": user.ID,
+		"sub": userID,
 		"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
 		"iat": time.Now().Unix(),
 		"nbf": time.Now().Unix(),
@@ -152,12 +340,53 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		"aud": app.config.auth.token.iss,
 	}
 	token, err := app.Authonticator.GenerateToken(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		AccessToken:  token,
+		RefreshToken: plainRefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(app.config.auth.token.exp.Seconds()),
+	}, nil
+}
+
+// newRefreshToken generates a random refresh token. Only its hash is kept on
+// the returned record; the plain value is handed to the client once.
+func (app *application) newRefreshToken() (*store.RefreshToken, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	plain := base64.RawURLEncoding.EncodeToString(buf)
+	return &store.RefreshToken{
+		TokenHash: hashToken(plain),
+		Expiry:    time.Now().Add(app.config.auth.token.refreshExp),
+	}, plain, nil
+}
+
+func hashToken(plain string) string {
+	hash := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(hash[:])
+}
+
+// JWKS Handler
+//
+//	@Summary		JSON Web Key Set
+//	@Description	Publishes the public keys access tokens are signed with, so other services can verify them. During a key rotation both the new and the previous keys are listed.
+//	@Tags			Authentication
+//	@Produce		json
+//	@Success		200	{object}	auth.JWKSet
+//	@Failure		500	{object}	errorResponse
+//	@Router			/.well-known/jwks.json [get]
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	jwks, err := app.Authonticator.JWKS()
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
-
-	if err := app.jsonResponse(w, http.StatusCreated, token); err != nil {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := writeJSON(w, http.StatusOK, jwks); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/SAURABH200301/Social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+const defaultCommentThreadDepth = 3
+
+type CreateCommentPayload struct {
+	Content  string `json:"content" validate:"required,max=1000"`
+	ParentID *int32 `json:"parent_id,omitempty"`
+}
+
+type UpdateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+// Create Comment Handler
+//
+//	@Summary		Comment on a post
+//	@Description	Adds a comment by the authenticated user to the given post, optionally as a reply to another comment on the same post.
+//	@Tags			Comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int						true	"Post ID"
+//	@Param			comment	body		CreateCommentPayload	true	"Comment Payload"
+//	@Success		201		{object}	store.Comments
+//	@Failure		400		{object}	errorResponse
+//	@Failure		404		{object}	errorResponse
+//	@Failure		500		{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/posts/{postID}/comments [post]
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	post := getPostFromCtx(r)
+
+	if payload.ParentID != nil {
+		parent, err := app.store.Comments.GetByID(r.Context(), *payload.ParentID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if parent == nil || parent.PostID != post.ID {
+			app.badRequestResponse(w, r, fmt.Errorf("parent comment %d does not exist on post %d", *payload.ParentID, post.ID))
+			return
+		}
+	}
+
+	comment := store.Comments{
+		PostID:   post.ID,
+		ParentID: payload.ParentID,
+		UserID:   user.ID,
+		Content:  payload.Content,
+		User: store.Users{
+			ID:       user.ID,
+			Username: user.Username,
+		},
+	}
+	if err := app.store.Comments.Create(r.Context(), &comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// Get Post Comments Handler
+//
+//	@Summary		List comments on a post
+//	@Description	Returns a page of a post's top-level comments, newest first, each with its replies nested up to the requested depth.
+//	@Tags			Comments
+//	@Produce		json
+//	@Param			postID	path		int	true	"Post ID"
+//	@Param			limit	query		int	false	"Number of comments to return per level"	default(20)	minimum(1)	maximum(100)
+//	@Param			offset	query		int	false	"Number of top-level comments to skip"		default(0)	minimum(0)
+//	@Param			depth	query		int	false	"Number of reply levels to load"			default(3)	minimum(1)	maximum(10)
+//	@Success		200		{array}		store.Comments
+//	@Failure		400		{object}	errorResponse
+//	@Failure		404		{object}	errorResponse
+//	@Failure		500		{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/posts/{postID}/comments [get]
+func (app *application) getPostCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	app.listCommentThread(w, r, nil)
+}
+
+// Get Comment Replies Handler
+//
+//	@Summary		List replies to a comment
+//	@Description	Returns a page of direct replies to a comment, oldest first, each with its own replies nested up to the requested depth. Use it to load more replies below a thread.
+//	@Tags			Comments
+//	@Produce		json
+//	@Param			postID		path		int	true	"Post ID"
+//	@Param			commentID	path		int	true	"Comment ID"
+//	@Param			limit		query		int	false	"Number of replies to return per level"	default(20)	minimum(1)	maximum(100)
+//	@Param			offset		query		int	false	"Number of direct replies to skip"		default(0)	minimum(0)
+//	@Param			depth		query		int	false	"Number of reply levels to load"		default(3)	minimum(1)	maximum(10)
+//	@Success		200			{array}		store.Comments
+//	@Failure		400			{object}	errorResponse
+//	@Failure		404			{object}	errorResponse
+//	@Failure		500			{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/posts/{postID}/comments/{commentID}/replies [get]
+func (app *application) getCommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+	app.listCommentThread(w, r, &comment.ID)
+}
+
+func (app *application) listCommentThread(w http.ResponseWriter, r *http.Request, parentID *int32) {
+	post := getPostFromCtx(r)
+
+	tq := store.CommentThreadQuery{
+		Limit:  20,
+		Offset: 0,
+		Depth:  defaultCommentThreadDepth,
+	}
+	query, err := tq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(query); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comments, err := app.store.Comments.GetThread(r.Context(), post.ID, parentID, query)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// Update Comment Handler
+//
+//	@Summary		Edit a comment
+//	@Description	Updates the content of a comment. Only the author or a moderator may edit it.
+//	@Tags			Comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path		int						true	"Post ID"
+//	@Param			commentID	path		int						true	"Comment ID"
+//	@Param			comment		body		UpdateCommentPayload	true	"Update Payload"
+//	@Success		200			{object}	store.Comments
+//	@Failure		400			{object}	errorResponse
+//	@Failure		403			{object}	errorResponse
+//	@Failure		404			{object}	errorResponse
+//	@Failure		500			{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/posts/{postID}/comments/{commentID} [patch]
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	var payload UpdateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	comment.Content = payload.Content
+
+	if err := app.store.Comments.Update(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// Delete Comment Handler
+//
+//	@Summary		Delete a comment
+//	@Description	Deletes a comment together with all of its replies. Only the author or a moderator may delete it.
+//	@Tags			Comments
+//	@Param			postID		path	int	true	"Post ID"
+//	@Param			commentID	path	int	true	"Comment ID"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		403	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/posts/{postID}/comments/{commentID} [delete]
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	if err := app.store.Comments.Delete(r.Context(), comment.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MIDDLEWARE TO FETCH COMMENT AND ADD TO CONTEXT
+type commentKey string
+
+const COMMENT_CTX_KEY commentKey = "comment"
+
+func (app *application) commentContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commentID, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 32)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		ctx := r.Context()
+		comment, err := app.store.Comments.GetByID(ctx, int32(commentID))
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, fmt.Errorf("comment with ID %d not found", commentID))
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		// a comment is only addressable through the post it belongs to
+		post := getPostFromCtx(r)
+		if comment.PostID != post.ID {
+			app.notFoundResponse(w, r, fmt.Errorf("comment with ID %d not found on post %d", commentID, post.ID))
+			return
+		}
+
+		ctx = context.WithValue(ctx, COMMENT_CTX_KEY, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromCtx(r *http.Request) *store.Comments {
+	comment, _ := r.Context().Value(COMMENT_CTX_KEY).(*store.Comments)
+	return comment
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"net/http"
+	"time"
+
+	"github.com/SAURABH200301/Social/internal/store"
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
@@ -42,6 +45,16 @@ func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request
 	_ = writeErrorJSON(w, http.StatusForbidden, "forbidden")
 }
 
+func (app *application) accountSuspendedResponse(w http.ResponseWriter, r *http.Request, user *store.Users) {
+	app.logger.Warnw("suspended account rejected", "method", r.Method, "path", r.URL.Path, "userID", user.ID)
+
+	message := "account is banned"
+	if user.BannedAt == nil {
+		message = "account is suspended until " + user.SuspendedUntil.UTC().Format(time.RFC3339)
+	}
+	_ = writeErrorJSON(w, http.StatusForbidden, message)
+}
+
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter string) {
 	app.logger.Warnw("rate limit exceeded", "method", r.Method, "path", r.URL.Path)
 	w.Header().Set("Retry-After", retryAfter)
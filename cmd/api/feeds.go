@@ -6,23 +6,29 @@ import (
 	"github.com/SAURABH200301/Social/internal/store"
 )
 
+// Get User Feed Handler
+//
 //	@Summary		Get User Feed
-//	@Description	Retrieve the feed for the authenticated user with pagination support.
+//	@Description	Retrieve the home timeline for the authenticated user: their own posts and posts from users they follow.
 //	@Tags			Feeds
 //	@Accept			json
 //	@Produce		json
-//	@Param			limit	query		int		false	"Number of posts to return"				default(1)		minimum(1)	maximum(100)
+//	@Param			limit	query		int		false	"Number of posts to return"				default(20)		minimum(1)	maximum(100)
 //	@Param			offset	query		int		false	"Number of posts to skip"				default(0)		minimum(0)
 //	@Param			sort	query		string	false	"Sort order of posts by creation time"	default(desc)	Enum(asc, desc)
-//	@Success		200		{object}	store.PostWithMetadata
+//	@Param			tags	query		string	false	"Comma separated tags the posts must contain"
+//	@Param			search	query		string	false	"Search term matched against title and content"
+//	@Param			since	query		string	false	"Only posts created at or after this time (YYYY-MM-DD[ HH:MM:SS])"
+//	@Param			until	query		string	false	"Only posts created at or before this time (YYYY-MM-DD[ HH:MM:SS])"
+//	@Success		200		{array}		store.PostWithMetadata
 //	@Failure		400		{object}	errorResponse	"Bad Request"
 //	@Failure		500		{object}	errorResponse	"Internal Server Error"
 //	@Security		BearerAuth
-//	@Router			/feeds [get]
+//	@Router			/users/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
 
 	pq := store.PaginationFeedQuery{
-		Limit:  1,
+		Limit:  20,
 		Offset: 0,
 		Sort:   "desc",
 	}
@@ -36,8 +42,8 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	ctx := r.Context()
-	userId := 1 //TO BE FETCHED FROM AUTH CONTEXT LATER
-	feed, err := app.store.Posts.GetUserFeed(ctx, userId, fq)
+	user := getUserFromCtx(r)
+	feed, err := app.store.Posts.GetUserFeed(ctx, user.ID, fq)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
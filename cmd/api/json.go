@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"slices"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -15,6 +16,9 @@ type errorResponse struct {
 
 func init() {
 	Validate = validator.New()
+	Validate.RegisterValidation("token_scope", func(fl validator.FieldLevel) bool {
+		return slices.Contains(TokenScopes, fl.Field().String())
+	})
 }
 
 func writeJSON(w http.ResponseWriter, status int, data any) error {
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/SAURABH200301/Social/internal/mailer"
+	"github.com/SAURABH200301/Social/internal/store"
+	"github.com/google/uuid"
+)
+
+type UnlockAccountPayload struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// Unlock Account Handler
+//
+//	@Summary		Unlock an account
+//	@Description	Lifts a lockout caused by repeated failed logins, using the token from the unlock email.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Param			payload	body	UnlockAccountPayload	true	"Unlock token"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Router			/authenticate/unlock [post]
+func (app *application) unlockAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UnlockAccountPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	userID, err := app.store.LoginThrottles.Unlock(r.Context(), hashToken(payload.Token))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequestResponse(w, r, fmt.Errorf("invalid or expired unlock token"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.recordAuthEvent(r, &userID, store.AuthEventAccountUnlocked)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Get User Auth Events Handler
+//
+//	@Summary		List authentication events of a user
+//	@Description	Returns failed logins, lockouts and unlocks recorded against an account, most recent first. Only moderators may see them.
+//	@Tags			Users
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Param			limit	query		int	false	"Number of events to return"	default(20)	minimum(1)	maximum(100)
+//	@Param			offset	query		int	false	"Number of events to skip"		default(0)	minimum(0)
+//	@Success		200		{array}		store.AuthEvent
+//	@Failure		400		{object}	errorResponse
+//	@Failure		403		{object}	errorResponse
+//	@Failure		500		{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/users/{userID}/auth-events [get]
+func (app *application) getUserAuthEventsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	pq := store.PaginationQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+	page, err := pq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(page); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	events, err := app.store.AuthEvents.ListByUserID(r.Context(), userID, page)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, events); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// reserveLoginAttempt counts an attempt against key before the credentials
+// are checked. While key is locked out or backing off after failed logins it
+// answers 429 instead and returns false.
+func (app *application) reserveLoginAttempt(w http.ResponseWriter, r *http.Request, key string) (*store.LoginThrottle, bool) {
+	cfg := app.config.auth.lockout
+	throttle, reserved, err := app.store.LoginThrottles.Reserve(r.Context(), key, store.ThrottlePolicy{
+		FreeAttempts: cfg.freeAttempts,
+		BaseDelay:    cfg.baseDelay,
+		MaxDelay:     cfg.maxDelay,
+		Window:       cfg.window,
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return nil, false
+	}
+	if reserved {
+		return throttle, true
+	}
+
+	// the wait may have run out between the two queries, so ask for a
+	// second at least
+	wait := max(app.loginRetryAfter(throttle, time.Now()), time.Second)
+	app.logger.Warnw("login attempt throttled", "key", key, "retryAfter", wait)
+	app.rateLimitExceededResponse(w, r, ceilSeconds(wait))
+	return nil, false
+}
+
+// releaseLoginAttempts gives back attempts reserved for credentials that
+// turned out to be right. The request goes on either way, so a failure is
+// only logged.
+func (app *application) releaseLoginAttempts(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := app.store.LoginThrottles.Release(ctx, key); err != nil {
+			app.logger.Errorw("failed to release login attempt", "error", err, "key", key)
+		}
+	}
+}
+
+// loginRetryAfter returns how long a throttled key has to wait: the rest of a
+// lockout, or a delay doubling with every failure past the free attempts.
+func (app *application) loginRetryAfter(throttle *store.LoginThrottle, now time.Time) time.Duration {
+	if throttle == nil {
+		return 0
+	}
+	if throttle.Locked(now) {
+		return throttle.LockedUntil.Sub(now)
+	}
+
+	cfg := app.config.auth.lockout
+	excess := throttle.Failures - cfg.freeAttempts
+	if excess <= 0 {
+		return 0
+	}
+	delay := cfg.maxDelay
+	if excess < 32 {
+		if d := cfg.baseDelay << (excess - 1); d > 0 && d < cfg.maxDelay {
+			delay = d
+		}
+	}
+	return max(throttle.LastFailedAt.Add(delay).Sub(now), 0)
+}
+
+// recordLoginFailure handles a failed login whose attempt was reserved
+// against the client IP and against an account key, locking either one once
+// it reaches its limit. user is nil when no account matched; the key is then
+// throttled the same way, but without auth events or an unlock email.
+func (app *application) recordLoginFailure(r *http.Request, ip, account *store.LoginThrottle, user *store.Users) error {
+	ctx := r.Context()
+	cfg := app.config.auth.lockout
+
+	if ip.Failures >= cfg.maxIPFailures {
+		if err := app.store.LoginThrottles.Lock(ctx, ip.Key, time.Now().Add(cfg.duration)); err != nil {
+			return err
+		}
+		app.logger.Warnw("client locked out after failed logins", "ip", clientIP(r), "failures", ip.Failures)
+		app.recordAuthEvent(r, nil, store.AuthEventIPLocked)
+	}
+
+	if user != nil {
+		app.recordAuthEvent(r, &user.ID, store.AuthEventLoginFailed)
+	}
+	if account.Failures >= cfg.maxFailures {
+		if err := app.store.LoginThrottles.Lock(ctx, account.Key, time.Now().Add(cfg.duration)); err != nil {
+			return err
+		}
+		app.logger.Warnw("account locked out after failed logins", "key", account.Key, "failures", account.Failures)
+		if user != nil {
+			app.recordAuthEvent(r, &user.ID, store.AuthEventAccountLocked)
+			// the account is locked already, the client leaving must not
+			// keep the unlock email from being queued
+			if err := app.queueAccountUnlock(context.WithoutCancel(ctx), user, account.Failures); err != nil {
+				app.logger.Errorw("failed to queue account unlock email", "error", err, "userID", user.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// clearLoginFailures forgets the failed logins of an account once a session
+// was started. The login already succeeded, so a failure is only logged.
+func (app *application) clearLoginFailures(ctx context.Context, userID int64) {
+	if err := app.store.LoginThrottles.Reset(ctx, store.AccountThrottleKey(userID)); err != nil {
+		app.logger.Errorw("failed to reset login failures", "error", err, "userID", userID)
+	}
+}
+
+// queueAccountUnlock creates an unlock token for a locked account and puts
+// the email carrying it into the outbox.
+func (app *application) queueAccountUnlock(ctx context.Context, user *store.Users, failures int) error {
+	cfg := app.config.auth.lockout
+
+	plainToken := uuid.New().String()
+	vars := struct {
+		Username  string
+		Failures  int
+		LockedFor string
+		UnlockURL string
+		ExpiresIn string
+	}{
+		Username:  user.Username,
+		Failures:  failures,
+		LockedFor: cfg.duration.String(),
+		UnlockURL: fmt.Sprintf("%s/account/unlock/%s", app.config.frontendURL, plainToken),
+		ExpiresIn: cfg.unlockExp.String(),
+	}
+	email, err := app.newEmail(mailer.AccountUnlockTemplate, user, vars)
+	if err != nil {
+		return err
+	}
+	return app.store.LoginThrottles.CreateUnlock(ctx, user.ID, hashToken(plainToken), cfg.unlockExp, email)
+}
+
+// recordAuthEvent writes an audit entry. A failed write is logged rather than
+// failing the request it describes.
+func (app *application) recordAuthEvent(r *http.Request, userID *int64, event string) {
+	authEvent := &store.AuthEvent{
+		UserID:    userID,
+		Event:     event,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	if err := app.store.AuthEvents.Create(r.Context(), authEvent); err != nil {
+		app.logger.Errorw("failed to record auth event", "error", err, "event", event)
+	}
+}
+
+// clientIP strips the port from r.RemoteAddr, which realIP has already set
+// from the proxy headers when the request came through a trusted proxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
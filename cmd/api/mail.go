@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/SAURABH200301/Social/internal/mailer"
+	"github.com/go-chi/chi/v5"
+)
+
+// Preview Email Handler
+//
+//	@Summary		Preview an email template
+//	@Description	Renders a template with its sample data, exactly as it would be sent but without sending anything. A locale without a translation falls back like a real send does, the response names the locale used. With format html or text only that part is returned, ready to open in a browser.
+//	@Tags			Admin
+//	@Produce		json
+//	@Produce		html
+//	@Produce		plain
+//	@Param			template	path		string	true	"Template name, such as user_invitation"
+//	@Param			locale		query		string	false	"Language tag"	default(en)
+//	@Param			format		query		string	false	"Response format"	Enums(json, html, text)	default(json)
+//	@Success		200			{object}	mailer.Message
+//	@Failure		400			{object}	errorResponse
+//	@Failure		403			{object}	errorResponse
+//	@Failure		404			{object}	errorResponse
+//	@Failure		500			{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/mail/preview/{template} [get]
+func (app *application) previewEmailHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "template")
+	if !strings.HasSuffix(name, ".tmpl") {
+		name += ".tmpl"
+	}
+
+	query := r.URL.Query()
+	locale := query.Get("locale")
+	if locale == "" {
+		locale = mailer.DefaultLocale
+	}
+	if len(locale) > 35 {
+		app.badRequestResponse(w, r, errors.New("locale must be at most 35 characters"))
+		return
+	}
+	format := query.Get("format")
+	switch format {
+	case "", "json", "html", "text":
+	default:
+		app.badRequestResponse(w, r, errors.New("format must be json, html or text"))
+		return
+	}
+
+	msg, err := app.mailTemplates.RenderSample(name, locale)
+	if err != nil {
+		switch {
+		case errors.Is(err, mailer.ErrUnknownTemplate):
+			app.notFoundResponse(w, r, fmt.Errorf("email template %s not found", chi.URLParam(r, "template")))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.writePreview(w, r, msg, format)
+}
+
+func (app *application) writePreview(w http.ResponseWriter, r *http.Request, msg *mailer.Message, format string) {
+	var contentType, body string
+	switch format {
+	case "html":
+		contentType, body = "text/html; charset=utf-8", msg.HTML
+	case "text":
+		contentType, body = "text/plain; charset=utf-8", msg.Text
+	default:
+		if err := app.jsonResponse(w, http.StatusOK, msg); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Language", msg.Locale)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(body)); err != nil {
+		app.logger.Errorw("failed to write email preview", "error", err)
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"crypto/rand"
 	"expvar"
+	"fmt"
+	"net/netip"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/SAURABH200301/Social/internal/auth"
@@ -52,13 +56,42 @@ func main() {
 			db:      env.GetInt("REDIS_DB", 0),
 			enabled: env.GetBool("REDIS_ENABLED", false),
 		},
+		cache: cacheConfig{
+			maxEntries: env.GetInt("CACHE_MAX_ENTRIES", 10000),
+		},
 		env: env.GetString("ENV", "development"),
 		mail: mailConfig{
-			invitationExp: time.Hour * 24 * 3, // 3 days
-			fromEmail:     env.GetString("FROM_EMAIL", "noreply@example.com"),
+			invitationExp:            time.Hour * 24 * 3, // 3 days
+			activationResendCooldown: env.GetDuration("MAIL_ACTIVATION_RESEND_COOLDOWN", time.Minute*5),
+			passwordResetExp:         time.Hour,
+			fromEmail:                env.GetString("FROM_EMAIL", "noreply@example.com"),
+			provider:                 env.GetString("MAILER_PROVIDER", mailProviderSendGrid),
 			sendGrid: sendGridConfig{
 				apiKey: env.GetString("SENDGRID_API_KEY", ""),
 			},
+			// defaults suit a local mail catcher such as MailHog
+			smtp: mailer.SMTPConfig{
+				Host:     env.GetString("SMTP_HOST", "localhost"),
+				Port:     env.GetInt("SMTP_PORT", 1025),
+				Username: env.GetString("SMTP_USERNAME", ""),
+				Password: env.GetString("SMTP_PASSWORD", ""),
+				TLSMode:  env.GetString("SMTP_TLS", mailer.SMTPTLSNone),
+			},
+			sweeper: sweeperConfig{
+				interval:         env.GetDuration("INVITATION_SWEEP_INTERVAL", time.Hour),
+				unactivatedGrace: env.GetDuration("UNACTIVATED_USER_GRACE", 0),
+			},
+			outbox: outboxConfig{
+				workers:      env.GetInt("MAIL_WORKERS", 4),
+				pollInterval: env.GetDuration("MAIL_POLL_INTERVAL", 5*time.Second),
+				lease:        5 * time.Minute,
+				maxAttempts:  env.GetInt("MAIL_MAX_ATTEMPTS", 8),
+				baseBackoff:  30 * time.Second,
+				maxBackoff:   6 * time.Hour,
+			},
+			unsubscribeSecret:  env.GetString("MAIL_UNSUBSCRIBE_SECRET", ""),
+			unsubscribeLinkTTL: env.GetDuration("MAIL_UNSUBSCRIBE_LINK_TTL", time.Hour*24*90), // 90 days
+			publicAPIURL:       env.GetString("MAIL_PUBLIC_API_URL", "http://localhost:8080"),
 		},
 		auth: authConfig{
 			basic: basicConfig{
@@ -66,15 +99,50 @@ func main() {
 				pass: env.GetString("AUTH_BASIC_PASS", "admin"),
 			},
 			token: tokenConfig{
-				secret: env.GetString("AUTH_TOKEN_SECRET", ""),
-				exp:    time.Hour * 24 * 3,
-				iss:    "socialwithgo",
+				signingKeyFile:       env.GetString("AUTH_TOKEN_SIGNING_KEY_FILE", ""),
+				verificationKeyFiles: splitList(env.GetString("AUTH_TOKEN_VERIFICATION_KEY_FILES", "")),
+				exp:                  time.Minute * 15,
+				refreshExp:           time.Hour * 24 * 30, // 30 days
+				iss:                  "socialwithgo",
+			},
+			mfa: mfaConfig{
+				issuer:       env.GetString("MFA_ISSUER", "Social With Go"),
+				challengeExp: time.Minute * 5,
+			},
+			lockout: lockoutConfig{
+				freeAttempts:  env.GetInt("LOGIN_FREE_ATTEMPTS", 3),
+				baseDelay:     time.Second,
+				maxDelay:      time.Minute * 15,
+				maxFailures:   env.GetInt("LOGIN_MAX_FAILURES", 10),
+				maxIPFailures: env.GetInt("LOGIN_MAX_IP_FAILURES", 50),
+				duration:      env.GetDuration("LOGIN_LOCKOUT_DURATION", time.Minute*30),
+				window:        time.Hour * 24,
+				unlockExp:     time.Hour * 24,
 			},
+			roleCacheTTL: time.Minute,
 		},
 		rateLimiter: ratelimiter.Config{
 			RequestsPerTimeFrame: env.GetInt("RATELIMITING_REQUESTS_COUNT", 20),
 			TimeFrame:            5 * time.Second,
 			Enabled:              env.GetBool("RATE_LIMITER_ENABLED", true),
+			Strategy:             env.GetString("RATE_LIMITER_STRATEGY", ratelimiter.StrategyFixedWindow),
+			Store:                env.GetString("RATE_LIMITER_STORE", ratelimiter.StoreMemory),
+			FallbackCooldown:     env.GetDuration("RATE_LIMITER_FALLBACK_COOLDOWN", 10*time.Second),
+			Policies: map[string]ratelimiter.Policy{
+				// logins, registrations and password resets
+				rateLimitPolicyAuth: {
+					RequestsPerTimeFrame: env.GetInt("RATE_LIMIT_AUTH_REQUESTS_COUNT", 10),
+					TimeFrame:            time.Minute,
+				},
+				rateLimitPolicyFeed: {
+					RequestsPerTimeFrame: env.GetInt("RATE_LIMIT_FEED_REQUESTS_COUNT", 100),
+					TimeFrame:            5 * time.Second,
+				},
+				rateLimitPolicyClient: {
+					RequestsPerTimeFrame: env.GetInt("RATE_LIMIT_CLIENT_REQUESTS_COUNT", 60),
+					TimeFrame:            5 * time.Second,
+				},
+			},
 		},
 	}
 
@@ -98,31 +166,63 @@ func main() {
 	}
 
 	//ratelimiting
-	rateLimiter := ratelimiter.NewFixedWindowRateLimiter(
-		cfg.rateLimiter.RequestsPerTimeFrame,
-		cfg.rateLimiter.TimeFrame,
-	)
+	cfg.trustedProxies, err = parseTrustedProxies(splitList(env.GetString("TRUSTED_PROXIES", "")))
+	if err != nil {
+		logger.Fatal(err)
+	}
 
-	cacheStorage := cache.NewRedisStorage(rdb)
+	cfg.rateLimiter.Logger = logger
+	rateLimiters, err := ratelimiter.NewPolicies(cfg.rateLimiter, rdb)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	//cache, kept in process when there is no Redis to share it
+	cacheStorage := cache.NewMemoryStorage(cfg.cache.maxEntries)
+	if cfg.redisCfg.enabled {
+		cacheStorage = cache.NewRedisStorage(rdb)
+	}
 
 	logger.Info("Database connection pool established")
 	store := store.NewPostgresStorage(db)
 
-	mailerClient := mailer.NewSendGridMailer(
-		cfg.mail.sendGrid.apiKey,
-		cfg.mail.fromEmail,
-	)
+	if cfg.mail.unsubscribeSecret == "" {
+		if cfg.env == "production" {
+			logger.Fatal("MAIL_UNSUBSCRIBE_SECRET must be set in production")
+		}
+		logger.Warn("no unsubscribe secret configured, generating an ephemeral one")
+		cfg.mail.unsubscribeSecret = rand.Text()
+	}
+	if err := checkPublicAPIURL(cfg.mail.publicAPIURL, cfg.env == "production"); err != nil {
+		logger.Fatal(err)
+	}
+
+	//every template is parsed and checked up front, a broken one stops startup
+	emailTemplates, err := mailer.LoadTemplates(mailer.FS)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	mailerClient, err := newMailer(cfg.mail, emailTemplates)
+	if err != nil {
+		logger.Fatal(err)
+	}
 
+	keys, err := loadTokenKeys(cfg, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
 	tokenHost := cfg.auth.token.iss
-	JWTAuthenicator := auth.NewJWTAuthenicator(cfg.auth.token.secret, tokenHost, tokenHost)
+	JWTAuthenicator := auth.NewJWTAuthenicator(keys, tokenHost, tokenHost)
 	app := &application{
 		config:        cfg,
 		store:         store,
 		cacheStorage:  cacheStorage,
 		logger:        logger,
 		mailer:        mailerClient,
+		mailTemplates: emailTemplates,
 		Authonticator: JWTAuthenicator,
-		rateLimiter:   rateLimiter,
+		rateLimiters:  rateLimiters,
+		roles:         newRoleCache(store.Roles, cfg.auth.roleCacheTTL),
 	}
 
 	//metrics data
@@ -134,7 +234,87 @@ func main() {
 	expvar.Publish("goroutines", expvar.Func(func() any {
 		return runtime.NumGoroutine()
 	}))
+	if cfg.rateLimiter.Store == ratelimiter.StoreRedis {
+		expvar.Publish("ratelimiter_redis_failures", expvar.Func(func() any {
+			failures := make(map[string]int64, len(rateLimiters))
+			for policy, limiter := range rateLimiters {
+				if rl, ok := limiter.(*ratelimiter.RedisRateLimiter); ok {
+					failures[policy] = rl.Failures()
+				}
+			}
+			return failures
+		}))
+	}
 
 	mux := app.mount()
 	logger.Fatal(app.run(mux))
 }
+
+// loadTokenKeys builds the JWT key set from the configured PEM files. Outside
+// production a throwaway key is generated when none is configured, so tokens
+// do not survive a restart.
+func loadTokenKeys(cfg config, logger *zap.SugaredLogger) (*auth.KeySet, error) {
+	var signing *auth.Key
+	var err error
+	switch {
+	case cfg.auth.token.signingKeyFile != "":
+		signing, err = auth.LoadKeyFile(cfg.auth.token.signingKeyFile)
+	case cfg.env == "production":
+		return nil, fmt.Errorf("AUTH_TOKEN_SIGNING_KEY_FILE must be set in production")
+	default:
+		logger.Warn("no token signing key configured, generating an ephemeral ES256 key")
+		signing, err = auth.GenerateKey()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	verification := make([]*auth.Key, 0, len(cfg.auth.token.verificationKeyFiles))
+	for _, path := range cfg.auth.token.verificationKeyFiles {
+		key, err := auth.LoadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		verification = append(verification, key)
+	}
+	return auth.NewKeySet(signing, verification...)
+}
+
+func newMailer(cfg mailConfig, templates *mailer.Templates) (mailer.Client, error) {
+	switch cfg.provider {
+	case mailProviderSendGrid:
+		return mailer.NewSendGridMailer(cfg.fromEmail, cfg.sendGrid.apiKey, templates), nil
+	case mailProviderSMTP:
+		return mailer.NewSMTPMailer(cfg.fromEmail, cfg.smtp, templates)
+	default:
+		return nil, fmt.Errorf("unknown mailer provider %q", cfg.provider)
+	}
+}
+
+// parseTrustedProxies reads TRUSTED_PROXIES, a list of addresses or CIDR
+// ranges such as "10.0.0.0/8, 192.168.1.4".
+func parseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	proxies := make([]netip.Prefix, 0, len(list))
+	for _, item := range list {
+		if addr, err := netip.ParseAddr(item); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
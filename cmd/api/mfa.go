@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SAURABH200301/Social/internal/auth"
+	"github.com/SAURABH200301/Social/internal/store"
+	"github.com/google/uuid"
+)
+
+const recoveryCodesCount = 10
+
+type MFAChallengeResponse struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int64  `json:"expires_in"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFACodePayload struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type CompleteMFAChallengePayload struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required,max=32"`
+}
+
+// Enroll TOTP Handler
+//
+//	@Summary		Start TOTP enrollment
+//	@Description	Generates a new TOTP secret for the authenticated user. Two-factor authentication is only enabled once a code from it is confirmed.
+//	@Tags			Authentication
+//	@Produce		json
+//	@Success		201	{object}	TOTPEnrollmentResponse
+//	@Failure		409	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/authenticate/mfa/totp [post]
+func (app *application) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.MFA.StartTOTPEnrollment(r.Context(), user.ID, secret); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, fmt.Errorf("two-factor authentication is already enabled"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	enrollment := TOTPEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(app.config.auth.mfa.issuer, user.Email, secret),
+	}
+	if err := app.jsonResponse(w, http.StatusCreated, enrollment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Confirm TOTP Handler
+//
+//	@Summary		Confirm TOTP enrollment
+//	@Description	Enables two-factor authentication once a code from the new secret is provided, and returns recovery codes. The codes are shown only this once.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MFACodePayload	true	"Code from the authenticator app"
+//	@Success		200		{object}	RecoveryCodesResponse
+//	@Failure		400		{object}	errorResponse
+//	@Failure		404		{object}	errorResponse
+//	@Failure		409		{object}	errorResponse
+//	@Failure		500		{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/authenticate/mfa/totp/confirm [post]
+func (app *application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MFACodePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	totp, err := app.store.MFA.GetTOTP(ctx, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, fmt.Errorf("no pending two-factor enrollment"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if totp.Enabled() {
+		app.conflictResponse(w, r, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, strings.TrimSpace(payload.Code), time.Now())
+	if !ok {
+		app.badRequestResponse(w, r, fmt.Errorf("invalid code"))
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashToken(code)
+	}
+
+	if err := app.store.MFA.ConfirmTOTP(ctx, user.ID, step, hashes); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Disable TOTP Handler
+//
+//	@Summary		Disable TOTP
+//	@Description	Turns off two-factor authentication after checking a current TOTP or recovery code.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Param			payload	body	MFACodePayload	true	"TOTP or recovery code"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/authenticate/mfa/totp/disable [post]
+func (app *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MFACodePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ok, err := app.verifySecondFactor(r.Context(), user.ID, payload.Code)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !ok {
+		app.badRequestResponse(w, r, fmt.Errorf("invalid code"))
+		return
+	}
+
+	if err := app.store.MFA.DisableTOTP(r.Context(), user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Complete MFA Challenge Handler
+//
+//	@Summary		Complete a two-factor login
+//	@Description	Exchanges the challenge returned by /authenticate/token and a TOTP or recovery code for an access token and a refresh token.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CompleteMFAChallengePayload	true	"Challenge and code"
+//	@Success		201		{object}	TokenResponse
+//	@Failure		400		{object}	errorResponse
+//	@Failure		401		{object}	errorResponse
+//	@Failure		429		{object}	errorResponse	"too many failed logins"
+//	@Failure		500		{object}	errorResponse
+//	@Router			/authenticate/token/mfa [post]
+func (app *application) completeMFAChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CompleteMFAChallengePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	challengeHash := hashToken(payload.ChallengeToken)
+	userID, err := app.store.MFA.AttemptChallenge(ctx, challengeHash)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.unauthorizationErrorResponse(w, r, fmt.Errorf("invalid or expired challenge"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// wrong codes count as failed logins, so the lockout covers the
+	// second factor as well as the password
+	ipKey, accountKey := store.IPThrottleKey(clientIP(r)), store.AccountThrottleKey(userID)
+	ipThrottle, ok := app.reserveLoginAttempt(w, r, ipKey)
+	if !ok {
+		return
+	}
+	accountThrottle, ok := app.reserveLoginAttempt(w, r, accountKey)
+	if !ok {
+		app.releaseLoginAttempts(ctx, ipKey)
+		return
+	}
+
+	valid, err := app.verifySecondFactor(ctx, userID, payload.Code)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !valid {
+		user, err := app.store.Users.GetByID(ctx, userID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if err := app.recordLoginFailure(r, ipThrottle, accountThrottle, user); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		app.unauthorizationErrorResponse(w, r, fmt.Errorf("invalid second factor for user %d", userID))
+		return
+	}
+	app.releaseLoginAttempts(ctx, ipKey)
+
+	if err := app.store.MFA.DeleteChallenge(ctx, challengeHash); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	tokens, err := app.startSession(ctx, userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.clearLoginFailures(ctx, userID)
+
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) createMFAChallenge(ctx context.Context, userID int64) (*MFAChallengeResponse, error) {
+	plainToken := uuid.New().String()
+	exp := app.config.auth.mfa.challengeExp
+	if err := app.store.MFA.CreateChallenge(ctx, userID, hashToken(plainToken), exp); err != nil {
+		return nil, err
+	}
+	return &MFAChallengeResponse{
+		MFARequired:    true,
+		ChallengeToken: plainToken,
+		ExpiresIn:      int64(exp.Seconds()),
+	}, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery
+// code. Each code is accepted only once.
+func (app *application) verifySecondFactor(ctx context.Context, userID int64, code string) (bool, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+
+	if len(code) != auth.TOTPDigits {
+		err := app.store.MFA.UseRecoveryCode(ctx, userID, hashToken(code))
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	totp, err := app.store.MFA.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !totp.Enabled() {
+		return false, nil
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	err = app.store.MFA.UseTOTPStep(ctx, userID, step)
+	if errors.Is(err, store.ErrConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
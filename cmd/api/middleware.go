@@ -3,11 +3,17 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"errors"
+	"expvar"
 	"fmt"
+	"math"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/SAURABH200301/Social/internal/ratelimiter"
 	"github.com/SAURABH200301/Social/internal/store"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -46,6 +52,59 @@ func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
 	}
 }
 
+// realIP replaces r.RemoteAddr with the client address a trusted proxy
+// forwarded. Requests that do not come straight from one of
+// config.trustedProxies keep the socket peer address, so a client cannot pick
+// the address login throttles and rate limits are keyed on by sending the
+// headers itself.
+func (app *application) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip, ok := app.forwardedIP(r); ok {
+			r.RemoteAddr = ip
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedIP returns the client address behind the trusted proxies. Every
+// proxy appends the address it got the request from to X-Forwarded-For, so
+// the list is read from the right, skipping the proxies themselves; anything
+// further left was written by the client and cannot be trusted.
+func (app *application) forwardedIP(r *http.Request) (string, bool) {
+	peer, err := netip.ParseAddr(clientIP(r))
+	if err != nil || !app.trustedProxy(peer) {
+		return "", false
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				return "", false
+			}
+			if !app.trustedProxy(addr) {
+				return addr.Unmap().String(), true
+			}
+		}
+		return "", false
+	}
+	if addr, err := netip.ParseAddr(r.Header.Get("X-Real-IP")); err == nil {
+		return addr.Unmap().String(), true
+	}
+	return "", false
+}
+
+func (app *application) trustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, proxy := range app.config.trustedProxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
 func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -61,31 +120,52 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 		}
 
 		token := parts[1]
-		jwtToken, err := app.Authonticator.ValidateToken(token)
-		if err != nil {
-			app.unauthorizationBasicErrorResponse(w, r, err)
-			return
-		}
+		ctx := r.Context()
+
+		var userID int64
+		var accessToken *store.PersonalAccessToken
+		if strings.HasPrefix(token, personalAccessTokenPrefix) {
+			var err error
+			accessToken, err = app.store.AccessTokens.Authenticate(ctx, hashToken(token))
+			if err != nil {
+				app.unauthorizationErrorResponse(w, r, err)
+				return
+			}
+			userID = accessToken.UserID
+		} else {
+			jwtToken, err := app.Authonticator.ValidateToken(token)
+			if err != nil {
+				app.unauthorizationBasicErrorResponse(w, r, err)
+				return
+			}
 
-		claims, _ := jwtToken.Claims.(jwt.MapClaims)
+			claims, _ := jwtToken.Claims.(jwt.MapClaims)
 
-		userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
-		if err != nil {
-			app.unauthorizationErrorResponse(w, r, err)
-			return
+			userID, err = strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+			if err != nil {
+				app.unauthorizationErrorResponse(w, r, err)
+				return
+			}
 		}
-		ctx := r.Context()
+
 		user, err := app.getUser(ctx, userID)
 		if err != nil {
 			app.unauthorizationErrorResponse(w, r, err)
 			return
 		}
-		ctx = context.WithValue(ctx, "userCtx", user)
+		if user.Suspended(time.Now()) {
+			app.accountSuspendedResponse(w, r, user)
+			return
+		}
+		ctx = context.WithValue(ctx, USER_CTX_KEY, user)
+		if accessToken != nil {
+			ctx = withAccessToken(ctx, accessToken)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func (app *application) checkPostOwnershipMiddleware(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+func (app *application) checkPostOwnershipMiddleware(permission string, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := getUserFromCtx(r)
 		post := getPostFromCtx(r)
@@ -95,7 +175,7 @@ func (app *application) checkPostOwnershipMiddleware(requiredRole string, next h
 			return
 		}
 
-		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		allowed, err := app.hasPermission(r.Context(), user, permission)
 		if err != nil {
 			app.internalServerError(w, r, err)
 			return
@@ -108,43 +188,151 @@ func (app *application) checkPostOwnershipMiddleware(requiredRole string, next h
 	})
 }
 
-func (app *application) checkRolePrecedence(ctx context.Context, user *store.Users, roleName string) (bool, error) {
-	role, err := app.store.Roles.GetByName(ctx, roleName)
-	if err != nil {
-		return false, err
-	}
-	return user.Role.Level >= role.Level, nil
+func (app *application) checkCommentOwnershipMiddleware(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromCtx(r)
+		comment := getCommentFromCtx(r)
+
+		if comment.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, err := app.hasPermission(r.Context(), user, permission)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			app.forbiddenResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
-func (app *application) getUser(ctx context.Context, userID int64) (*store.Users, error) {
+// userCacheStats counts how user lookups were served: hits, misses,
+// not_found_hits (users cached as missing) and fills (database reads, one per
+// coalesced group of misses).
+var userCacheStats = expvar.NewMap("user_cache")
 
-	if !app.config.redisCfg.enabled {
-		return app.store.Users.GetByID(ctx, userID)
-	}
+// getUser reads a user through the cache. Concurrent misses for the same user
+// share a single database read, and users that do not exist are cached too,
+// so neither a cold user nor a bogus ID can stampede Postgres.
+func (app *application) getUser(ctx context.Context, userID int64) (*store.Users, error) {
 	user, err := app.cacheStorage.Users.Get(ctx, userID)
-	if err != nil {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		userCacheStats.Add("not_found_hits", 1)
 		return nil, err
+	case err != nil:
+		// a cache outage should not take authentication down with it
+		app.logger.Errorw("failed to read cached user", "error", err, "userID", userID)
+	case user != nil:
+		userCacheStats.Add("hits", 1)
+		return user, nil
 	}
-	if user == nil {
+	userCacheStats.Add("misses", 1)
+
+	v, err, _ := app.userFills.Do(strconv.FormatInt(userID, 10), func() (any, error) {
+		userCacheStats.Add("fills", 1)
+		// the fill is shared, so it must not fail because the request that
+		// happened to start it went away
+		ctx := context.WithoutCancel(ctx)
+
+		// read before loading the user, so a change committed meanwhile
+		// keeps the loaded copy out of the cache
+		generation, err := app.cacheStorage.Users.Generation(ctx, userID)
+		if err != nil {
+			app.logger.Errorw("failed to read cached user generation", "error", err, "userID", userID)
+		}
+
 		user, err := app.store.Users.GetByID(ctx, userID)
 		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				if err := app.cacheStorage.Users.SetNotFound(ctx, userID); err != nil {
+					app.logger.Errorw("failed to cache missing user", "error", err, "userID", userID)
+				}
+			}
 			return nil, err
 		}
-		if err = app.cacheStorage.Users.Set(ctx, user); err != nil {
-			return nil, err
+		if err := app.cacheStorage.Users.Set(ctx, user, generation); err != nil {
+			app.logger.Errorw("failed to cache user", "error", err, "userID", userID)
 		}
+		return user, nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	// every caller of a shared fill gets its own copy
+	user = new(store.Users)
+	*user = *v.(*store.Users)
 	return user, nil
 }
 
-func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.config.rateLimiter.Enabled {
-			if allow, retryAfter := app.rateLimiter.Allow(r.RemoteAddr); !allow {
-				app.rateLimitExceededResponse(w, r, retryAfter.String())
+// invalidateUserCache drops the cached copy of userID after it changed, so
+// the next request sees the change right away.
+func (app *application) invalidateUserCache(ctx context.Context, userID int64) {
+	if err := app.cacheStorage.Users.Delete(ctx, userID); err != nil {
+		app.logger.Errorw("failed to invalidate cached user", "error", err, "userID", userID)
+	}
+}
+
+// Rate limit policies applied to groups of routes. Any other route is
+// limited by ratelimiter.DefaultPolicy.
+const (
+	rateLimitPolicyAuth = "auth"
+	rateLimitPolicyFeed = "feed"
+	// rateLimitPolicyClient runs ahead of AuthTokenMiddleware and is keyed on
+	// the client IP, so requests failing authentication are counted too and
+	// bogus tokens cannot be tried against the database without limit.
+	rateLimitPolicyClient = "client"
+)
+
+// rateLimit counts requests against the named policy. Authenticated requests
+// are keyed on the user, so it has to run after AuthTokenMiddleware to see
+// them; anything else is keyed on the client IP. Every response carries the
+// RateLimit-* headers of the policy closest to exhaustion among those the
+// request went through.
+func (app *application) rateLimit(policy string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.config.rateLimiter.Enabled {
+				next.ServeHTTP(w, r)
 				return
 			}
-		}
-		next.ServeHTTP(w, r)
-	})
+
+			key := "ip:" + clientIP(r)
+			if user, ok := r.Context().Value(USER_CTX_KEY).(*store.Users); ok && user != nil {
+				key = "user:" + strconv.FormatInt(user.ID, 10)
+			}
+
+			result := app.rateLimiters[policy].Allow(key)
+			setRateLimitHeaders(w.Header(), result)
+			if !result.Allowed {
+				app.rateLimitExceededResponse(w, r, ceilSeconds(result.RetryAfter))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setRateLimitHeaders describes result in the RateLimit-* headers, unless
+// they already describe a policy with fewer requests remaining. Chained
+// policies would contradict each other otherwise, and the client has to
+// follow the tightest one anyway.
+func setRateLimitHeaders(h http.Header, result ratelimiter.Result) {
+	if current, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err == nil && current < result.Remaining {
+		return
+	}
+	h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	h.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+}
+
+// ceilSeconds formats d as whole seconds, rounded up, the way the
+// Retry-After and RateLimit-Reset headers expect it.
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
 }
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SAURABH200301/Social/internal/mailer"
+	"github.com/SAURABH200301/Social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// emailNotifications maps the templates of optional emails to the kind of
+// notification they are. Every other template is an account email, which
+// is always sent and whose unsubscribe link turns off every notification.
+var emailNotifications = map[string]string{
+	mailer.NewFollowerTemplate: store.NotificationNewFollower,
+}
+
+var (
+	errInvalidUnsubscribeToken = errors.New("invalid unsubscribe link")
+	errExpiredUnsubscribeToken = errors.New("expired unsubscribe link")
+)
+
+// unsubscribeToken signs a user, a notification kind and the time the token
+// was issued at. Tokens are accepted for mail.unsubscribeLinkTTL, long enough
+// for links in recent emails to keep working, while a leaked old link stops
+// being usable.
+func (app *application) unsubscribeToken(userID int64, kind string, issuedAt time.Time) string {
+	claims := strconv.FormatInt(userID, 10) + ":" + kind + ":" + strconv.FormatInt(issuedAt.Unix(), 10)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(app.unsubscribeMAC(payload))
+}
+
+// parseUnsubscribeToken checks the signature and age of a token and returns
+// the user and the notification kind it was issued for.
+func (app *application) parseUnsubscribeToken(token string, now time.Time) (int64, string, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, "", errInvalidUnsubscribeToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, app.unsubscribeMAC(payload)) {
+		return 0, "", errInvalidUnsubscribeToken
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return 0, "", errInvalidUnsubscribeToken
+	}
+	claims := strings.Split(string(decoded), ":")
+	if len(claims) != 3 {
+		return 0, "", errInvalidUnsubscribeToken
+	}
+	userID, err := strconv.ParseInt(claims[0], 10, 64)
+	if err != nil {
+		return 0, "", errInvalidUnsubscribeToken
+	}
+	issuedAt, err := strconv.ParseInt(claims[2], 10, 64)
+	if err != nil {
+		return 0, "", errInvalidUnsubscribeToken
+	}
+	if now.Sub(time.Unix(issuedAt, 0)) > app.config.mail.unsubscribeLinkTTL {
+		return 0, "", errExpiredUnsubscribeToken
+	}
+	return userID, claims[1], nil
+}
+
+func (app *application) unsubscribeMAC(payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(app.config.mail.unsubscribeSecret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// unsubscribeLinks returns the links of an email to userID: a page of the
+// frontend for the footer, and the API endpoint mail clients POST to for
+// one-click unsubscribes.
+func (app *application) unsubscribeLinks(userID int64, template string) (page, oneClick string) {
+	kind, ok := emailNotifications[template]
+	if !ok {
+		kind = store.NotificationAll
+	}
+	token := app.unsubscribeToken(userID, kind, time.Now())
+
+	return fmt.Sprintf("%s/unsubscribe/%s", app.config.frontendURL, token),
+		fmt.Sprintf("%s/v1/notifications/unsubscribe/%s", strings.TrimSuffix(app.config.mail.publicAPIURL, "/"), token)
+}
+
+// checkPublicAPIURL makes sure one-click unsubscribe links can be built from
+// rawURL. Mail clients ignore links that are not HTTPS, so production
+// refuses anything else; elsewhere plain HTTP is allowed for local testing.
+func checkPublicAPIURL(rawURL string, production bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("MAIL_PUBLIC_API_URL must be an absolute URL, got %q", rawURL)
+	}
+	if production && u.Scheme != "https" {
+		return fmt.Errorf("MAIL_PUBLIC_API_URL must use https in production, got %q", rawURL)
+	}
+	return nil
+}
+
+// Get Notification Settings Handler
+//
+//	@Summary		Get notification settings
+//	@Description	Shows which optional emails the authenticated user gets.
+//	@Tags			Notifications
+//	@Produce		json
+//	@Success		200	{object}	store.NotificationSettings
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/notifications [get]
+func (app *application) getNotificationSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	settings, err := app.store.NotificationSettings.Get(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, settings); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type UpdateNotificationSettingsPayload struct {
+	NewFollower  *bool `json:"new_follower,omitempty"`
+	WeeklyDigest *bool `json:"weekly_digest,omitempty"`
+}
+
+// Update Notification Settings Handler
+//
+//	@Summary		Update notification settings
+//	@Description	Turns optional emails of the authenticated user on or off. Settings left out of the payload keep their value.
+//	@Tags			Notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdateNotificationSettingsPayload	true	"Notification settings"
+//	@Success		200		{object}	store.NotificationSettings
+//	@Failure		400		{object}	errorResponse
+//	@Failure		500		{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/notifications [patch]
+func (app *application) updateNotificationSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	var payload UpdateNotificationSettingsPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	settings, err := app.store.NotificationSettings.Get(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if payload.NewFollower != nil {
+		settings.NewFollower = *payload.NewFollower
+	}
+	if payload.WeeklyDigest != nil {
+		settings.WeeklyDigest = *payload.WeeklyDigest
+	}
+
+	if err := app.store.NotificationSettings.Update(ctx, settings); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, settings); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type UpdateLanguagePayload struct {
+	// Language is a BCP 47 tag such as "en" or "es-MX"
+	Language string `json:"language" validate:"required,max=35,bcp47_language_tag"`
+}
+
+// Update Language Handler
+//
+//	@Summary		Update the email language
+//	@Description	Changes the language the authenticated user gets emails in. Emails fall back to the closest available translation, or English.
+//	@Tags			Notifications
+//	@Accept			json
+//	@Param			payload	body	UpdateLanguagePayload	true	"Language"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/notifications/language [patch]
+func (app *application) updateLanguageHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	var payload UpdateLanguagePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	if err := app.store.Users.UpdateLanguage(ctx, user.ID, payload.Language); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.invalidateUserCache(ctx, user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unsubscribe Handler
+//
+//	@Summary		Unsubscribe from emails
+//	@Description	Turns off the emails an unsubscribe link was issued for, without signing in. Mail clients call it for one-click unsubscribes (RFC 8058), the frontend unsubscribe page calls it too. Links from account emails turn off every optional email. Links expire a while after the email was sent.
+//	@Tags			Notifications
+//	@Param			token	path	string	true	"Unsubscribe token"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Router			/notifications/unsubscribe/{token} [post]
+func (app *application) unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, kind, err := app.parseUnsubscribeToken(chi.URLParam(r, "token"), time.Now())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.NotificationSettings.Unsubscribe(r.Context(), userID, kind); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, fmt.Errorf("user with ID %d not found", userID))
+		case errors.Is(err, store.ErrUnknownNotification):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.logger.Infow("user unsubscribed from emails", "userID", userID, "kind", kind)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SAURABH200301/Social/internal/mailer"
+	"github.com/SAURABH200301/Social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// newEmail prepares an email to user for the outbox. vars are stored as JSON
+// and handed back to the template as a map when the email is delivered.
+func (app *application) newEmail(template string, user *store.Users, vars any) (*store.OutboxEmail, error) {
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode variables of %s: %w", template, err)
+	}
+	return &store.OutboxEmail{
+		UserID:   user.ID,
+		Template: template,
+		Locale:   user.Language,
+		Username: user.Username,
+		Email:    user.Email,
+		Data:     data,
+		OneTime:  mailer.HasOneTimeLink(template),
+		Sandbox:  app.config.env != "production",
+	}, nil
+}
+
+// queueEmail puts an email into the outbox, to be delivered by the workers.
+func (app *application) queueEmail(ctx context.Context, template string, user *store.Users, vars any) error {
+	email, err := app.newEmail(template, user, vars)
+	if err != nil {
+		return err
+	}
+	return app.store.EmailOutbox.Enqueue(ctx, email)
+}
+
+// runEmailWorkers delivers the outbox until ctx is done. Every worker claims
+// its own emails, so the workers of several API instances can share one
+// outbox.
+func (app *application) runEmailWorkers(ctx context.Context) {
+	cfg := app.config.mail.outbox
+	if cfg.workers <= 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for range cfg.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.runEmailWorker(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (app *application) runEmailWorker(ctx context.Context) {
+	cfg := app.config.mail.outbox
+	ticker := time.NewTicker(cfg.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// keep going while there is a backlog, poll once it is drained
+		for ctx.Err() == nil && app.deliverNextEmail(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverNextEmail claims and sends one due email. It reports whether one
+// was claimed, meaning more may be waiting. Emails are claimed one at a time
+// so the lease only ever has to cover a single send.
+func (app *application) deliverNextEmail(ctx context.Context) bool {
+	emails, err := app.store.EmailOutbox.Claim(ctx, 1, app.config.mail.outbox.lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			app.logger.Errorw("failed to claim queued emails", "error", err)
+		}
+		return false
+	}
+	if len(emails) == 0 {
+		return false
+	}
+	app.deliverEmail(emails[0])
+	return true
+}
+
+// deliverEmail sends a claimed email and records the outcome. It runs to the
+// end even during shutdown, which waits for it, so the email is not left
+// leased.
+func (app *application) deliverEmail(email *store.OutboxEmail) {
+	ctx := context.Background()
+	cfg := app.config.mail.outbox
+
+	suppressed, err := app.sendEmail(ctx, email)
+	switch {
+	case suppressed:
+		app.recordEmailOutcome(email, "suppress", app.store.EmailOutbox.Suppress(ctx, email, "user unsubscribed"))
+	case err == nil:
+		app.recordEmailOutcome(email, "mark as sent", app.store.EmailOutbox.MarkSent(ctx, email))
+	case errors.Is(err, mailer.ErrRejected) || email.Attempts >= cfg.maxAttempts:
+		app.logger.Errorw("giving up on email", "error", err, "emailID", email.ID, "template", email.Template, "attempts", email.Attempts)
+		app.recordEmailOutcome(email, "dead-letter", app.store.EmailOutbox.DeadLetter(ctx, email, err.Error()))
+	default:
+		retryAt := time.Now().Add(emailBackoff(cfg.baseBackoff, cfg.maxBackoff, email.Attempts))
+		app.logger.Warnw("failed to send email", "error", err, "emailID", email.ID, "attempts", email.Attempts, "retryAt", retryAt)
+		app.recordEmailOutcome(email, "reschedule", app.store.EmailOutbox.Reschedule(ctx, email, err.Error(), retryAt))
+	}
+}
+
+// recordEmailOutcome logs a failure to store what happened to an email.
+// ErrNotFound means the lease ran out during the attempt and another worker
+// owns the email now.
+func (app *application) recordEmailOutcome(email *store.OutboxEmail, action string, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, store.ErrNotFound):
+		app.logger.Warnw("lost the lease on email before recording its outcome", "action", action, "emailID", email.ID, "attempts", email.Attempts)
+	default:
+		app.logger.Errorw("failed to "+action+" email", "error", err, "emailID", email.ID)
+	}
+}
+
+// sendEmail sends an email with the unsubscribe links of its user, unless
+// the user opted out of its kind, which it reports instead. Opt-outs are
+// checked here rather than when queueing, so they also stop emails that
+// were already waiting.
+func (app *application) sendEmail(ctx context.Context, email *store.OutboxEmail) (bool, error) {
+	if kind, ok := emailNotifications[email.Template]; ok {
+		settings, err := app.store.NotificationSettings.Get(ctx, email.UserID)
+		if err != nil {
+			return false, err
+		}
+		if !settings.Allows(kind) {
+			return true, nil
+		}
+	}
+
+	var vars map[string]any
+	if err := json.Unmarshal(email.Data, &vars); err != nil {
+		return false, err
+	}
+	if vars == nil {
+		vars = make(map[string]any)
+	}
+	page, oneClick := app.unsubscribeLinks(email.UserID, email.Template)
+	vars["UnsubscribeURL"] = page
+
+	return false, app.mailer.Send(email.Template, email.Locale, email.Username, email.Email, vars, oneClick, email.Sandbox)
+}
+
+// emailBackoff doubles the wait after every failed attempt, from base up to
+// maxDelay.
+func emailBackoff(base, maxDelay time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// List Emails Handler
+//
+//	@Summary		List queued emails
+//	@Description	Lists the email outbox, newest first, optionally only the emails in one status. Template variables are never shown, they can contain one-time links.
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			status	query		string	false	"Email status"	Enums(pending, sending, sent, dead, suppressed)
+//	@Param			limit	query		int		false	"Number of emails to return"	default(20)	minimum(1)	maximum(100)
+//	@Param			offset	query		int		false	"Number of emails to skip"		default(0)	minimum(0)
+//	@Success		200		{array}		store.OutboxEmail
+//	@Failure		400		{object}	errorResponse
+//	@Failure		403		{object}	errorResponse
+//	@Failure		500		{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/emails [get]
+func (app *application) listEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	eq := store.EmailOutboxQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+	query, err := eq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(query); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	emails, err := app.store.EmailOutbox.List(r.Context(), query)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, emails); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get Email Handler
+//
+//	@Summary		Get a queued email
+//	@Description	Shows the delivery state of one email in the outbox.
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			emailID	path		int	true	"Email ID"
+//	@Success		200		{object}	store.OutboxEmail
+//	@Failure		400		{object}	errorResponse
+//	@Failure		403		{object}	errorResponse
+//	@Failure		404		{object}	errorResponse
+//	@Failure		500		{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/emails/{emailID} [get]
+func (app *application) getEmailHandler(w http.ResponseWriter, r *http.Request) {
+	emailID, err := strconv.ParseInt(chi.URLParam(r, "emailID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	email, err := app.store.EmailOutbox.GetByID(r.Context(), emailID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, fmt.Errorf("email with ID %d not found", emailID))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, email); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Retry Email Handler
+//
+//	@Summary		Retry a queued email
+//	@Description	Makes a pending or dead-lettered email due right away. A dead-lettered email gets a fresh set of attempts, unless it carried a one-time link: that link was discarded, so the user has to request a new one.
+//	@Tags			Admin
+//	@Param			emailID	path	int	true	"Email ID"
+//	@Success		202
+//	@Failure		400	{object}	errorResponse
+//	@Failure		403	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/emails/{emailID}/retry [post]
+func (app *application) retryEmailHandler(w http.ResponseWriter, r *http.Request) {
+	emailID, err := strconv.ParseInt(chi.URLParam(r, "emailID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.EmailOutbox.Retry(r.Context(), emailID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, fmt.Errorf("no pending or retryable dead-lettered email with ID %d", emailID))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.logger.Infow("email retry requested", "emailID", emailID, "by", getUserFromCtx(r).ID)
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/SAURABH200301/Social/internal/mailer"
+	"github.com/SAURABH200301/Social/internal/store"
+	"github.com/google/uuid"
+)
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// Forgot Password Handler
+//
+//	@Summary		Request a password reset
+//	@Description	Emails a one-time password reset link if an active account uses the address. Always answers 202 so the endpoint cannot be used to discover accounts.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Param			payload	body	ForgotPasswordPayload	true	"Account email"
+//	@Success		202
+//	@Failure		400	{object}	errorResponse
+//	@Router			/authenticate/password/forgot [post]
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	app.sendPasswordReset(r.Context(), payload.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordReset queues a reset link for the active account using email,
+// if there is one. The caller gets the same answer either way, so failures
+// are only logged.
+func (app *application) sendPasswordReset(ctx context.Context, email string) {
+	user, err := app.store.Users.GetByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			app.logger.Errorw("failed to look up account for password reset", "error", err)
+		}
+		return
+	}
+
+	plainToken := uuid.New().String()
+	resetEmail, err := app.passwordResetEmail(user, plainToken)
+	if err == nil {
+		err = app.store.Users.CreatePasswordReset(ctx, user.ID, hashToken(plainToken), app.config.mail.passwordResetExp, resetEmail)
+	}
+	if err != nil {
+		app.logger.Errorw("failed to create password reset", "error", err, "userID", user.ID)
+	}
+}
+
+func (app *application) passwordResetEmail(user *store.Users, plainToken string) (*store.OutboxEmail, error) {
+	vars := struct {
+		Username  string
+		ResetURL  string
+		ExpiresIn string
+	}{
+		Username:  user.Username,
+		ResetURL:  fmt.Sprintf("%s/password/reset/%s", app.config.frontendURL, plainToken),
+		ExpiresIn: app.config.mail.passwordResetExp.String(),
+	}
+
+	return app.newEmail(mailer.PasswordResetTemplate, user, vars)
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+// Reset Password Handler
+//
+//	@Summary		Reset a password
+//	@Description	Sets a new password using the token from the reset email. The token can be used once, and every existing session of the account is revoked.
+//	@Tags			Authentication
+//	@Accept			json
+//	@Param			payload	body	ResetPasswordPayload	true	"Reset token and new password"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Router			/authenticate/password/reset [post]
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResetPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var user store.Users
+	if err := user.Password.Set(payload.Password); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Users.ResetPassword(r.Context(), payload.Token, &user); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequestResponse(w, r, fmt.Errorf("invalid or expired reset token"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -39,14 +39,10 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		app.badRequestResponse(w, r, err)
 		return
 	}
-	uid, ok := r.Context().Value("userID").(int64)
-	if !ok {
-		_ = writeErrorJSON(w, http.StatusUnauthorized, "missing user id")
-		return
-	}
+	user := getUserFromCtx(r)
 
 	post := store.Post{
-		UserID:    uid,
+		UserID:    user.ID,
 		Content:   postPayload.Content,
 		Title:     postPayload.Title,
 		CreatedAt: time.Now().Format(time.RFC3339),
@@ -67,11 +63,11 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 // Get Post Handler
 //
 //	@Summary		Get a post by ID
-//	@Description	Retrieves a post by its ID, including associated comments.
+//	@Description	Retrieves a post by its ID with its reaction counts and the number of comments. Comments are listed by /posts/{postID}/comments.
 //	@Tags			Posts
 //	@Produce		json
 //	@Param			postID	path		int	true	"Post ID"
-//	@Success		200		{object}	store.Post
+//	@Success		200		{object}	store.PostWithMetadata
 //	@Failure		400		{object}	errorResponse
 //	@Failure		404		{object}	errorResponse
 //	@Failure		500		{object}	errorResponse
@@ -79,17 +75,20 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 //	@Router			/posts/{postID} [get]
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
-	comments, err := app.store.Comments.GetCommentsByPostID(r.Context(), int32(post.ID))
+	commentsCount, err := app.store.Comments.CountByPostID(r.Context(), post.ID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
-	post.Comments = make([]store.Comments, len(comments))
-	for i, comment := range comments {
-		post.Comments[i] = *comment
+
+	reactions, err := app.store.Reactions.GetSummaries(r.Context(), []int32{post.ID}, getUserFromCtx(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
 	}
+	post.Reactions = reactions[post.ID]
 
-	err = app.jsonResponse(w, http.StatusOK, post)
+	err = app.jsonResponse(w, http.StatusOK, store.PostWithMetadata{Post: *post, CommentsCount: commentsCount})
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -120,6 +119,7 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		app.notFoundResponse(w, r, err)
 		return
 	}
+	app.invalidatePostCache(r.Context(), int32(postID))
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -169,9 +169,12 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	if err := app.store.Posts.UpdatePost(r.Context(), post); err != nil {
+		// the cached copy may be the stale version that lost the edit
+		app.invalidatePostCache(r.Context(), post.ID)
 		app.internalServerError(w, r, err)
 		return
 	}
+	app.refreshPostCache(r.Context(), post)
 
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
@@ -199,7 +202,7 @@ func (app *application) postContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		ctx := r.Context()
-		post, err := app.store.Posts.GetByID(ctx, int32(postID))
+		post, err := app.getPost(ctx, int32(postID))
 		if err != nil {
 			app.notFoundResponse(w, r, err)
 			return
@@ -210,7 +213,42 @@ func (app *application) postContextMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+func (app *application) getPost(ctx context.Context, postID int32) (*store.Post, error) {
+	post, err := app.cacheStorage.Posts.Get(ctx, postID)
+	if err != nil {
+		// a cache outage should not take posts down with it
+		app.logger.Errorw("failed to read cached post", "error", err, "postID", postID)
+	}
+	if post != nil {
+		return post, nil
+	}
+
+	post, err = app.store.Posts.GetByID(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.cacheStorage.Posts.Set(ctx, post); err != nil {
+		app.logger.Errorw("failed to cache post", "error", err, "postID", postID)
+	}
+	return post, nil
+}
+
+// refreshPostCache replaces the cached copy of a post after it was updated,
+// so readers get the new version right away.
+func (app *application) refreshPostCache(ctx context.Context, post *store.Post) {
+	if err := app.cacheStorage.Posts.Set(ctx, post); err != nil {
+		app.logger.Errorw("failed to refresh cached post", "error", err, "postID", post.ID)
+		app.invalidatePostCache(ctx, post.ID)
+	}
+}
+
+func (app *application) invalidatePostCache(ctx context.Context, postID int32) {
+	if err := app.cacheStorage.Posts.Delete(ctx, postID); err != nil {
+		app.logger.Errorw("failed to invalidate cached post", "error", err, "postID", postID)
+	}
+}
+
 func getPostFromCtx(r *http.Request) *store.Post {
-	post, _ := r.Context().Value("post").(*store.Post)
+	post, _ := r.Context().Value(POST_CTX_KEY).(*store.Post)
 	return post
 }
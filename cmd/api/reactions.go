@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/SAURABH200301/Social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Add Reaction Handler
+//
+//	@Summary		React to a post
+//	@Description	Adds a reaction of the given type by the authenticated user. Reacting twice with the same type has no effect.
+//	@Tags			Reactions
+//	@Param			postID	path	int		true	"Post ID"
+//	@Param			type	path	string	true	"Reaction type"	Enums(like, love, haha, wow, sad, angry)
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/posts/{postID}/reactions/{type} [put]
+func (app *application) addReactionHandler(w http.ResponseWriter, r *http.Request) {
+	reactionType, err := getReactionTypeParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := getUserFromCtx(r)
+	post := getPostFromCtx(r)
+
+	if err := app.store.Reactions.Add(r.Context(), post.ID, user.ID, reactionType); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Remove Reaction Handler
+//
+//	@Summary		Remove a reaction from a post
+//	@Description	Removes the authenticated user's reaction of the given type.
+//	@Tags			Reactions
+//	@Param			postID	path	int		true	"Post ID"
+//	@Param			type	path	string	true	"Reaction type"	Enums(like, love, haha, wow, sad, angry)
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/posts/{postID}/reactions/{type} [delete]
+func (app *application) removeReactionHandler(w http.ResponseWriter, r *http.Request) {
+	reactionType, err := getReactionTypeParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := getUserFromCtx(r)
+	post := getPostFromCtx(r)
+
+	if err := app.store.Reactions.Remove(r.Context(), post.ID, user.ID, reactionType); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, fmt.Errorf("no %s reaction on post %d", reactionType, post.ID))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getReactionTypeParam(r *http.Request) (string, error) {
+	reactionType := strings.ToLower(chi.URLParam(r, "type"))
+	if !store.IsValidReactionType(reactionType) {
+		return "", fmt.Errorf("unknown reaction type %q, expected one of %s", reactionType, strings.Join(store.ReactionTypes, ", "))
+	}
+	return reactionType, nil
+}
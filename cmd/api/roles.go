@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SAURABH200301/Social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type CreateRolePayload struct {
+	Name        string   `json:"name" validate:"required,min=3,max=50"`
+	Description string   `json:"description" validate:"max=255"`
+	Level       int      `json:"level" validate:"min=0"`
+	Permissions []string `json:"permissions" validate:"dive,required,max=100"`
+}
+
+type SetRolePermissionsPayload struct {
+	Permissions []string `json:"permissions" validate:"required,dive,required,max=100"`
+}
+
+type UpdateUserRolePayload struct {
+	Role string `json:"role" validate:"required,max=50"`
+}
+
+// List Permissions Handler
+//
+//	@Summary		List permissions
+//	@Description	Lists every permission that can be granted to a role.
+//	@Tags			Admin
+//	@Produce		json
+//	@Success		200	{array}		store.Permission
+//	@Failure		403	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/permissions [get]
+func (app *application) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.store.Roles.ListPermissions(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, permissions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// List Roles Handler
+//
+//	@Summary		List roles
+//	@Description	Lists every role with the permissions granted to it.
+//	@Tags			Admin
+//	@Produce		json
+//	@Success		200	{array}		store.Role
+//	@Failure		403	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/roles [get]
+func (app *application) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.store.Roles.List(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, roles); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Create Role Handler
+//
+//	@Summary		Create a role
+//	@Description	Creates a role with the given permissions. The role must rank below the caller's own, and the caller must hold every permission it grants.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateRolePayload	true	"Role"
+//	@Success		201		{object}	store.Role
+//	@Failure		400		{object}	errorResponse
+//	@Failure		403		{object}	errorResponse
+//	@Failure		409		{object}	errorResponse
+//	@Failure		500		{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/roles [post]
+func (app *application) createRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	allowed, err := app.canManageRole(ctx, getUserFromCtx(r), payload.Level, payload.Permissions)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !allowed {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	role := &store.Role{
+		Name:        payload.Name,
+		Description: payload.Description,
+		Level:       payload.Level,
+		Permissions: payload.Permissions,
+	}
+	if err := app.store.Roles.Create(ctx, role); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, fmt.Errorf("role %s already exists", payload.Name))
+		case errors.Is(err, store.ErrUnknownPermission):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.roles.Invalidate()
+
+	if err := app.jsonResponse(w, http.StatusCreated, role); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Set Role Permissions Handler
+//
+//	@Summary		Set the permissions of a role
+//	@Description	Replaces the permissions granted to a role. The role must rank below the caller's own, so nobody can edit their own role, and the caller must hold every permission it grants.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			roleID	path		int							true	"Role ID"
+//	@Param			payload	body		SetRolePermissionsPayload	true	"Permissions"
+//	@Success		200		{object}	store.Role
+//	@Failure		400		{object}	errorResponse
+//	@Failure		403		{object}	errorResponse
+//	@Failure		404		{object}	errorResponse
+//	@Failure		500		{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/roles/{roleID}/permissions [put]
+func (app *application) setRolePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	roleID, err := strconv.ParseInt(chi.URLParam(r, "roleID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload SetRolePermissionsPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	target, err := app.roles.Get(ctx, roleID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, fmt.Errorf("role with ID %d not found", roleID))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	allowed, err := app.canManageRole(ctx, getUserFromCtx(r), target.Level, payload.Permissions)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !allowed {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	if err := app.store.Roles.SetPermissions(ctx, roleID, payload.Permissions); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, fmt.Errorf("role with ID %d not found", roleID))
+		case errors.Is(err, store.ErrUnknownPermission):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.roles.Invalidate()
+
+	role, err := app.roles.Get(ctx, roleID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, role); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Update User Role Handler
+//
+//	@Summary		Change the role of a user
+//	@Description	Assigns a role to a user. Nobody can change their own role, the role of someone ranking as high as themselves, or hand out a role ranking above their own.
+//	@Tags			Admin
+//	@Accept			json
+//	@Param			userID	path	int						true	"User ID"
+//	@Param			payload	body	UpdateUserRolePayload	true	"Role name"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		403	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/users/{userID}/role [put]
+func (app *application) updateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateUserRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	target, ok := app.loadManagedUser(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	role, err := app.store.Roles.GetByName(ctx, payload.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequestResponse(w, r, fmt.Errorf("role %s does not exist", payload.Role))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	// nobody can hand out a role ranking above their own
+	if role.Level > getUserFromCtx(r).Role.Level {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	if err := app.store.Users.UpdateRole(ctx, target.ID, role.ID); err != nil {
+		app.managedUserError(w, r, target.ID, err)
+		return
+	}
+	app.invalidateUserCache(ctx, target.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MIDDLEWARE TO ENFORCE PERMISSIONS
+
+// requirePermission only admits users whose role grants permission.
+func (app *application) requirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, err := app.hasPermission(r.Context(), getUserFromCtx(r), permission)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if !allowed {
+				app.forbiddenResponse(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (app *application) hasPermission(ctx context.Context, user *store.Users, permission string) (bool, error) {
+	role, err := app.roles.Get(ctx, user.Role.ID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return role.HasPermission(permission), nil
+}
+
+// canManageRole reports whether user may create or edit a role of the given
+// level granting permissions. They must outrank the role and hold every
+// permission themselves, so managing roles never grants more than the
+// caller already has.
+func (app *application) canManageRole(ctx context.Context, user *store.Users, level int, permissions []string) (bool, error) {
+	own, err := app.roles.Get(ctx, user.Role.ID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if level >= own.Level {
+		return false, nil
+	}
+	for _, permission := range permissions {
+		if !own.HasPermission(permission) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+type roleLister interface {
+	List(context.Context) ([]*store.Role, error)
+}
+
+// roleCache keeps every role and its permissions in memory, so permission
+// checks do not hit the database. The set is reloaded once it is older than
+// ttl, or right away after it was edited through this instance.
+type roleCache struct {
+	roles roleLister
+	ttl   time.Duration
+
+	mu       sync.RWMutex
+	byID     map[int64]*store.Role
+	loadedAt time.Time
+}
+
+func newRoleCache(roles roleLister, ttl time.Duration) *roleCache {
+	return &roleCache{roles: roles, ttl: ttl}
+}
+
+// Get returns the role with the given ID, or ErrNotFound.
+func (c *roleCache) Get(ctx context.Context, roleID int64) (*store.Role, error) {
+	c.mu.RLock()
+	role, ok := c.byID[roleID]
+	fresh := c.byID != nil && time.Since(c.loadedAt) < c.ttl
+	c.mu.RUnlock()
+	if fresh {
+		if !ok {
+			return nil, store.ErrNotFound
+		}
+		return role, nil
+	}
+
+	if err := c.load(ctx); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if role, ok := c.byID[roleID]; ok {
+		return role, nil
+	}
+	return nil, store.ErrNotFound
+}
+
+func (c *roleCache) Invalidate() {
+	c.mu.Lock()
+	c.byID = nil
+	c.mu.Unlock()
+}
+
+func (c *roleCache) load(ctx context.Context) error {
+	roles, err := c.roles.List(ctx)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int64]*store.Role, len(roles))
+	for _, role := range roles {
+		byID[role.ID] = role
+	}
+
+	c.mu.Lock()
+	c.byID = byID
+	c.loadedAt = time.Now()
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// runInvitationSweeper periodically purges expired invitations and, when a
+// grace period is configured, accounts that were never activated.
+func (app *application) runInvitationSweeper(ctx context.Context) {
+	cfg := app.config.mail.sweeper
+	if cfg.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(cfg.interval)
+	defer ticker.Stop()
+
+	for {
+		app.sweepInvitations(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) sweepInvitations(ctx context.Context) {
+	grace := app.config.mail.sweeper.unactivatedGrace
+	if grace > 0 {
+		deleted, err := app.store.Users.DeleteUnactivated(ctx, time.Now().Add(-grace))
+		if err != nil {
+			app.logger.Errorw("failed to delete unactivated users", "error", err)
+		} else if deleted > 0 {
+			app.logger.Infow("deleted unactivated users", "count", deleted)
+		}
+	}
+
+	purged, err := app.store.Users.DeleteExpiredInvitations(ctx)
+	if err != nil {
+		app.logger.Errorw("failed to purge expired invitations", "error", err)
+		return
+	}
+	if purged > 0 {
+		app.logger.Infow("purged expired invitations", "count", purged)
+	}
+}
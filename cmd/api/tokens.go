@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SAURABH200301/Social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// personalAccessTokenPrefix tells personal access tokens apart from JWTs in
+// the Authorization header and makes leaked tokens easy to scan for.
+const personalAccessTokenPrefix = "sgp_"
+
+const (
+	ScopePostsRead      = "posts:read"
+	ScopePostsWrite     = "posts:write"
+	ScopeCommentsWrite  = "comments:write"
+	ScopeReactionsWrite = "reactions:write"
+	ScopeFeedRead       = "feed:read"
+	ScopeUsersRead      = "users:read"
+	ScopeUsersWrite     = "users:write"
+)
+
+// TokenScopes are the scopes a personal access token can be granted. The
+// token_scope validation checks payloads against this list.
+var TokenScopes = []string{
+	ScopePostsRead,
+	ScopePostsWrite,
+	ScopeCommentsWrite,
+	ScopeReactionsWrite,
+	ScopeFeedRead,
+	ScopeUsersRead,
+	ScopeUsersWrite,
+}
+
+type CreateAccessTokenPayload struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,token_scope"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"required,min=1,max=365"`
+}
+
+type CreatedAccessTokenResponse struct {
+	*store.PersonalAccessToken
+	Token string `json:"token"`
+}
+
+// Create Access Token Handler
+//
+//	@Summary		Create a personal access token
+//	@Description	Mints a named, expiring token limited to the given scopes, for bots and CI jobs. The token value is returned only once.
+//	@Tags			Tokens
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateAccessTokenPayload	true	"Token name, scopes and lifetime"
+//	@Success		201		{object}	CreatedAccessTokenResponse
+//	@Failure		400		{object}	errorResponse
+//	@Failure		403		{object}	errorResponse
+//	@Failure		500		{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/tokens [post]
+func (app *application) createAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateAccessTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	plainToken := personalAccessTokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	user := getUserFromCtx(r)
+	token := &store.PersonalAccessToken{
+		UserID:    user.ID,
+		Name:      payload.Name,
+		TokenHash: hashToken(plainToken),
+		Scopes:    payload.Scopes,
+		Expiry:    time.Now().Add(time.Duration(payload.ExpiresInDays) * 24 * time.Hour),
+	}
+	if err := app.store.AccessTokens.Create(r.Context(), token); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, CreatedAccessTokenResponse{PersonalAccessToken: token, Token: plainToken}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// List Access Tokens Handler
+//
+//	@Summary		List personal access tokens
+//	@Description	Lists the authenticated user's tokens that have not been revoked. Token values are never returned.
+//	@Tags			Tokens
+//	@Produce		json
+//	@Success		200	{array}		store.PersonalAccessToken
+//	@Failure		403	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/tokens [get]
+func (app *application) listAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	tokens, err := app.store.AccessTokens.ListByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Revoke Access Token Handler
+//
+//	@Summary		Revoke a personal access token
+//	@Description	Revokes one of the authenticated user's tokens. It stops working immediately.
+//	@Tags			Tokens
+//	@Param			tokenID	path	int	true	"Token ID"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		403	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/tokens/{tokenID} [delete]
+func (app *application) revokeAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := strconv.ParseInt(chi.URLParam(r, "tokenID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	if err := app.store.AccessTokens.Revoke(r.Context(), user.ID, tokenID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, fmt.Errorf("token with ID %d not found", tokenID))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MIDDLEWARE TO ENFORCE TOKEN SCOPES
+type accessTokenKey string
+
+const ACCESS_TOKEN_CTX_KEY accessTokenKey = "accessToken"
+
+// requireScope rejects requests authenticated with a personal access token
+// that lacks scope. Interactive sessions (JWTs) are not scoped.
+func (app *application) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token := getAccessTokenFromCtx(r); token != nil && !token.HasScope(scope) {
+				app.logger.Warnw("missing token scope", "scope", scope, "tokenID", token.ID)
+				app.forbiddenResponse(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireSession only admits interactive sessions, keeping account
+// management out of reach of personal access tokens.
+func (app *application) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getAccessTokenFromCtx(r) != nil {
+			app.forbiddenResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func withAccessToken(ctx context.Context, token *store.PersonalAccessToken) context.Context {
+	return context.WithValue(ctx, ACCESS_TOKEN_CTX_KEY, token)
+}
+
+func getAccessTokenFromCtx(r *http.Request) *store.PersonalAccessToken {
+	token, _ := r.Context().Value(ACCESS_TOKEN_CTX_KEY).(*store.PersonalAccessToken)
+	return token
+}
@@ -1,39 +1,94 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
+	"github.com/SAURABH200301/Social/internal/mailer"
 	"github.com/SAURABH200301/Social/internal/store"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 )
 
+type userKey string
+
+const USER_CTX_KEY userKey = "user"
+
+// UserProfile is what any signed-in user may see of another. Moderation
+// details such as suspensions are only shown by the admin API.
+type UserProfile struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// Email is only shown to the user themselves and to those allowed to
+	// search users, who see it there anyway.
+	Email     string     `json:"email,omitempty"`
+	CreatedAt string     `json:"created_at"`
+	IsActive  bool       `json:"is_active"`
+	Role      store.Role `json:"role"`
+	store.FollowCounts
+}
+
 // GetUser godoc
 //
 //	@Summary		Get User by ID
-//	@Description	Get a user by their unique ID.
+//	@Description	Get a user by their unique ID. The email address is only included for the user themselves and for moderators allowed to search users.
 //	@Tags			Users
 //	@Accept			json
 //	@Produce		json
 //	@Param			userID	path		int	true	"User ID"
-//	@Success		200		{object}	store.Users
+//	@Success		200		{object}	UserProfile
 //	@Failure		400		{object}	errorResponse
 //	@Failure		500		{object}	errorResponse
+//	@Security		BearerAuth
 //	@Router			/users/{userID} [get]
 func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
-	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 32)
+	userID, err := getUserIDParam(r)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
 	ctx := r.Context()
-	user, err := app.cacheStorage.Users.Get(ctx, userID)
+	user, err := app.getUser(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	counts, err := app.store.Followers.GetCounts(ctx, userID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
-	err = app.jsonResponse(w, http.StatusOK, user)
+	profile := UserProfile{
+		ID:           user.ID,
+		Username:     user.Username,
+		CreatedAt:    user.CreatedAt,
+		IsActive:     user.IsActive,
+		Role:         user.Role,
+		FollowCounts: *counts,
+	}
+
+	viewer := getUserFromCtx(r)
+	showEmail := viewer.ID == user.ID
+	if !showEmail {
+		showEmail, err = app.hasPermission(ctx, viewer, store.PermissionUserSearch)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+	if showEmail {
+		profile.Email = user.Email
+	}
+	err = app.jsonResponse(w, http.StatusOK, profile)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -63,7 +118,245 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+type ResendActivationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// Resend Activation Handler
+//
+//	@Summary		Resend the activation email
+//	@Description	Issues a fresh activation link for an account that has not been activated yet, replacing any previous one. A new link is issued at most once every few minutes per account. Always answers 202 so the endpoint cannot be used to discover accounts.
+//	@Tags			Users
+//	@Accept			json
+//	@Param			payload	body	ResendActivationPayload	true	"Account email"
+//	@Success		202
+//	@Failure		400	{object}	errorResponse
+//	@Router			/users/activate/resend [post]
+func (app *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResendActivationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	app.resendActivation(r.Context(), payload.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// resendActivation issues a new activation link, unless email has no
+// inactive account or was sent one recently. Either way the caller gets the
+// same answer, so failures are only logged.
+func (app *application) resendActivation(ctx context.Context, email string) {
+	plainToken := uuid.New().String()
+	newEmail := func(user *store.Users) (*store.OutboxEmail, error) {
+		return app.activationEmail(user, plainToken)
+	}
+	mail := app.config.mail
+	user, err := app.store.Users.RotateInvitation(ctx, email, hashToken(plainToken), mail.invitationExp, mail.activationResendCooldown, newEmail)
+	switch {
+	case err == nil, errors.Is(err, store.ErrNotFound):
+	case errors.Is(err, store.ErrInvitationCooldown):
+		app.logger.Infow("activation email sent recently, not resending", "userID", user.ID)
+	case user != nil:
+		app.logger.Errorw("failed to resend activation email", "error", err, "userID", user.ID)
+	default:
+		app.logger.Errorw("failed to resend activation email", "error", err)
+	}
+}
+
+// Follow User Handler
+//
+//	@Summary		Follow a user
+//	@Description	The authenticated user starts following the user with the given ID.
+//	@Tags			Users
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		409	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/users/{userID}/follow [put]
+func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
+	follower := getUserFromCtx(r)
+	userID, err := getUserIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if follower.ID == userID {
+		app.badRequestResponse(w, r, fmt.Errorf("users cannot follow themselves"))
+		return
+	}
+
+	err = app.store.Followers.Follow(r.Context(), follower.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, fmt.Errorf("already following user %d", userID))
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, fmt.Errorf("user with ID %d not found", userID))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.queueNewFollowerEmail(r.Context(), follower, userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// queueNewFollowerEmail tells userID about their new follower, the first
+// time follower follows them, so following and unfollowing in a loop cannot
+// flood their inbox. The follow already happened, so a failure is only
+// logged. Users who opted out are skipped when the email is delivered.
+func (app *application) queueNewFollowerEmail(ctx context.Context, follower *store.Users, userID int64) {
+	first, err := app.store.Followers.ClaimNotification(ctx, follower.ID, userID)
+	if err != nil {
+		app.logger.Errorw("failed to check earlier follow notifications", "error", err, "userID", userID)
+		return
+	}
+	if !first {
+		return
+	}
+
+	user, err := app.getUser(ctx, userID)
+	if err != nil {
+		app.logger.Errorw("failed to load followed user", "error", err, "userID", userID)
+		return
+	}
+
+	vars := struct {
+		Username     string
+		FollowerName string
+		ProfileURL   string
+	}{
+		Username:     user.Username,
+		FollowerName: follower.Username,
+		ProfileURL:   fmt.Sprintf("%s/users/%d", app.config.frontendURL, follower.ID),
+	}
+	if err := app.queueEmail(ctx, mailer.NewFollowerTemplate, user, vars); err != nil {
+		app.logger.Errorw("failed to queue new follower email", "error", err, "userID", userID)
+	}
+}
+
+// Unfollow User Handler
+//
+//	@Summary		Unfollow a user
+//	@Description	The authenticated user stops following the user with the given ID.
+//	@Tags			Users
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/users/{userID}/unfollow [put]
+func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	follower := getUserFromCtx(r)
+	userID, err := getUserIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if follower.ID == userID {
+		app.badRequestResponse(w, r, fmt.Errorf("users cannot unfollow themselves"))
+		return
+	}
+
+	err = app.store.Followers.Unfollow(r.Context(), follower.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, fmt.Errorf("not following user %d", userID))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Get Followers Handler
+//
+//	@Summary		List followers of a user
+//	@Description	Returns the users following the given user, most recent first.
+//	@Tags			Users
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Param			limit	query		int	false	"Number of users to return"	default(20)	minimum(1)	maximum(100)
+//	@Param			offset	query		int	false	"Number of users to skip"	default(0)	minimum(0)
+//	@Success		200		{array}		store.PublicUser
+//	@Failure		400		{object}	errorResponse
+//	@Failure		500		{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/users/{userID}/followers [get]
+func (app *application) getUserFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollowGraph(w, r, app.store.Followers.GetFollowers)
+}
+
+// Get Following Handler
+//
+//	@Summary		List users followed by a user
+//	@Description	Returns the users the given user follows, most recent first.
+//	@Tags			Users
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Param			limit	query		int	false	"Number of users to return"	default(20)	minimum(1)	maximum(100)
+//	@Param			offset	query		int	false	"Number of users to skip"	default(0)	minimum(0)
+//	@Success		200		{array}		store.PublicUser
+//	@Failure		400		{object}	errorResponse
+//	@Failure		500		{object}	errorResponse
+//	@Security		BearerAuth
+//	@Router			/users/{userID}/following [get]
+func (app *application) getUserFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollowGraph(w, r, app.store.Followers.GetFollowing)
+}
+
+type followListFunc func(context.Context, int64, *store.PaginationQuery) ([]*store.PublicUser, error)
+
+func (app *application) listFollowGraph(w http.ResponseWriter, r *http.Request, list followListFunc) {
+	userID, err := getUserIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	pq := store.PaginationQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+	page, err := pq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(page); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	users, err := list(r.Context(), userID, page)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func getUserIDParam(r *http.Request) (int64, error) {
+	return strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+}
+
 func getUserFromCtx(r *http.Request) *store.Users {
-	user, _ := r.Context().Value("user").(*store.Users)
+	user, _ := r.Context().Value(USER_CTX_KEY).(*store.Users)
 	return user
 }
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS followers (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    follower_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, follower_id),
+    CHECK (user_id <> follower_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS followers;
+-- +goose StatementEnd
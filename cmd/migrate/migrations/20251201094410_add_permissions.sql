@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS permissions (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id BIGINT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id BIGINT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('post.update.any', 'Edit posts of other users'),
+    ('post.delete.any', 'Delete posts of other users'),
+    ('comment.update.any', 'Edit comments of other users'),
+    ('comment.delete.any', 'Delete comments of other users'),
+    ('user.auth_events.read', 'See failed logins and lockouts of any account'),
+    ('user.ban', 'Suspend and ban users'),
+    ('user.role.update', 'Change the role of a user'),
+    ('role.manage', 'Create roles and assign permissions to them')
+ON CONFLICT (name) DO NOTHING;
+
+-- moderators keep what the old level check gave them, admins get everything
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'moderator' AND p.name IN (
+    'post.update.any', 'post.delete.any', 'comment.update.any', 'comment.delete.any', 'user.auth_events.read'
+)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'admin'
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+-- +goose StatementEnd
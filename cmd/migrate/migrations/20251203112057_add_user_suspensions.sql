@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE IF EXISTS users
+ADD COLUMN IF NOT EXISTS suspended_until TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS banned_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS suspension_reason TEXT NOT NULL DEFAULT '';
+
+INSERT INTO permissions (name, description) VALUES
+    ('user.search', 'Search all accounts, including inactive ones'),
+    ('user.suspend', 'Suspend users for a limited time and lift suspensions'),
+    ('user.password.reset', 'Force a user to reset their password')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE (r.name = 'moderator' AND p.name IN ('user.search', 'user.suspend'))
+   OR (r.name = 'admin' AND p.name IN ('user.search', 'user.suspend', 'user.password.reset'))
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name IN ('user.search', 'user.suspend', 'user.password.reset');
+
+ALTER TABLE IF EXISTS users
+DROP COLUMN IF EXISTS suspension_reason,
+DROP COLUMN IF EXISTS banned_at,
+DROP COLUMN IF EXISTS suspended_until;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE IF EXISTS users
+ADD COLUMN IF NOT EXISTS language VARCHAR(35) NOT NULL DEFAULT 'en';
+
+ALTER TABLE IF EXISTS email_outbox
+ADD COLUMN IF NOT EXISTS locale VARCHAR(35) NOT NULL DEFAULT 'en';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE IF EXISTS email_outbox
+DROP COLUMN IF EXISTS locale;
+
+ALTER TABLE IF EXISTS users
+DROP COLUMN IF EXISTS language;
+-- +goose StatementEnd
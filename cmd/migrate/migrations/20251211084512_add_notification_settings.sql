@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS notification_settings (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email_new_follower BOOLEAN NOT NULL DEFAULT TRUE,
+    email_comment BOOLEAN NOT NULL DEFAULT TRUE,
+    email_mention BOOLEAN NOT NULL DEFAULT TRUE,
+    weekly_digest BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS notification_settings;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS follow_notifications (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    follower_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    notified_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, follower_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS follow_notifications;
+-- +goose StatementEnd
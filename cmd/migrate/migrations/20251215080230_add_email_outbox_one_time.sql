@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE email_outbox ADD COLUMN IF NOT EXISTS one_time BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE email_outbox SET one_time = TRUE
+WHERE template IN ('user_invitation.tmpl', 'password_reset.tmpl', 'account_unlock.tmpl');
+
+UPDATE email_outbox SET data = '{}' WHERE one_time AND status = 'dead';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS one_time;
+-- +goose StatementEnd
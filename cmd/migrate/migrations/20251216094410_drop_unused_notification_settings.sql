@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE notification_settings DROP COLUMN IF EXISTS email_comment;
+ALTER TABLE notification_settings DROP COLUMN IF EXISTS email_mention;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE notification_settings ADD COLUMN IF NOT EXISTS email_comment BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE notification_settings ADD COLUMN IF NOT EXISTS email_mention BOOLEAN NOT NULL DEFAULT TRUE;
+-- +goose StatementEnd
@@ -5,4 +5,5 @@ import "github.com/golang-jwt/jwt/v5"
 type Authenicator interface {
 	GenerateToken(claims jwt.Claims) (string, error)
 	ValidateToken(token string) (*jwt.Token, error)
+	JWKS() (*JWKSet, error)
 }
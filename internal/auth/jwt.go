@@ -7,21 +7,25 @@ import (
 )
 
 type JWTAuthenicator struct {
-	secret string
-	aud    string
-	iss    string
+	keys *KeySet
+	aud  string
+	iss  string
 }
 
-func NewJWTAuthenicator(secret, aud, iss string) *JWTAuthenicator {
+func NewJWTAuthenicator(keys *KeySet, aud, iss string) *JWTAuthenicator {
 	return &JWTAuthenicator{
-		secret, iss, aud,
+		keys: keys,
+		aud:  aud,
+		iss:  iss,
 	}
 }
 
 func (a *JWTAuthenicator) GenerateToken(claims jwt.Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	key := a.keys.Signing()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
 
-	tokenString, err := token.SignedString([]byte(a.secret))
+	tokenString, err := token.SignedString(key.Private)
 	if err != nil {
 		return "", err
 	}
@@ -30,14 +34,27 @@ func (a *JWTAuthenicator) GenerateToken(claims jwt.Claims) (string, error) {
 
 func (a *JWTAuthenicator) ValidateToken(token string) (*jwt.Token, error) {
 	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, ok := t.Header["kid"].(string)
+		if !ok {
+			return nil, fmt.Errorf("token has no key id")
+		}
+		key, ok := a.keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %s", kid)
+		}
+		// the key decides the algorithm, never the token header
+		if t.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
 		}
-		return []byte(a.secret), nil
+		return key.Public, nil
 	},
 		jwt.WithExpirationRequired(),
 		jwt.WithAudience(a.aud),
 		jwt.WithIssuer(a.iss),
-		jwt.WithValidMethods(([]string{jwt.SigningMethodES256.Name})),
+		jwt.WithValidMethods([]string{jwt.SigningMethodES256.Name, jwt.SigningMethodEdDSA.Alg()}),
 	)
 }
+
+func (a *JWTAuthenicator) JWKS() (*JWKSet, error) {
+	return a.keys.JWKS()
+}
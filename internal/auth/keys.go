@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is an asymmetric key identified by its RFC 7638 thumbprint. Private is
+// nil for keys that are only trusted for verification.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySet holds the key new tokens are signed with and every key tokens may
+// still be verified with. Rotating means promoting a new signing key while
+// the previous one stays in the verification set until its tokens expire.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+	order   []string
+}
+
+func NewKeySet(signing *Key, verification ...*Key) (*KeySet, error) {
+	if signing == nil || signing.Private == nil {
+		return nil, fmt.Errorf("a private signing key is required")
+	}
+	ks := &KeySet{
+		signing: signing,
+		keys:    make(map[string]*Key),
+	}
+	for _, key := range append([]*Key{signing}, verification...) {
+		if _, ok := ks.keys[key.ID]; ok {
+			continue
+		}
+		ks.keys[key.ID] = key
+		ks.order = append(ks.order, key.ID)
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) Signing() *Key {
+	return ks.signing
+}
+
+func (ks *KeySet) Lookup(kid string) (*Key, bool) {
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// LoadKeyFile reads a PEM encoded ES256 (P-256) or Ed25519 key. Both private
+// and public keys are accepted; a private key also yields its public half.
+func LoadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file %s: %v", path, err)
+	}
+
+	if priv, err := jwt.ParseECPrivateKeyFromPEM(data); err == nil {
+		return newKey(priv, &priv.PublicKey)
+	}
+	if priv, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+		signer := priv.(crypto.Signer)
+		return newKey(signer, signer.Public())
+	}
+	if pub, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+		return newKey(nil, pub)
+	}
+	if pub, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		return newKey(nil, pub)
+	}
+	return nil, fmt.Errorf("key file %s is not a PEM encoded P-256 or Ed25519 key", path)
+}
+
+// GenerateKey creates an in-memory ES256 key, used when no key file is
+// configured outside production.
+func GenerateKey() (*Key, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newKey(priv, &priv.PublicKey)
+}
+
+func newKey(priv crypto.Signer, pub crypto.PublicKey) (*Key, error) {
+	var method jwt.SigningMethod
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported curve %s, only P-256 is supported", k.Curve.Params().Name)
+		}
+		method = jwt.SigningMethodES256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+
+	key := &Key{
+		Method:  method,
+		Private: priv,
+		Public:  pub,
+	}
+	jwk, err := key.JWK()
+	if err != nil {
+		return nil, err
+	}
+	key.ID, err = jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// JWK is the public half of a key in RFC 7517 format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *Key) JWK() (JWK, error) {
+	jwk := JWK{
+		Kid: k.ID,
+		Alg: k.Method.Alg(),
+		Use: "sig",
+	}
+	switch pub := k.Public.(type) {
+	case *ecdsa.PublicKey:
+		ecdh, err := pub.ECDH()
+		if err != nil {
+			return JWK{}, err
+		}
+		// uncompressed point: 0x04 || X || Y, 32 bytes each for P-256
+		point := ecdh.Bytes()
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		jwk.X = base64.RawURLEncoding.EncodeToString(point[1:33])
+		jwk.Y = base64.RawURLEncoding.EncodeToString(point[33:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, fmt.Errorf("unsupported key type %T", k.Public)
+	}
+	return jwk, nil
+}
+
+// Thumbprint computes the RFC 7638 thumbprint over the required members of
+// the key, in lexicographic order.
+func (j JWK) Thumbprint() (string, error) {
+	var members any
+	switch j.Kty {
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{j.Crv, j.Kty, j.X, j.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Crv, j.Kty, j.X}
+	default:
+		return "", fmt.Errorf("unsupported key type %s", j.Kty)
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// JWKS returns the public keys of the set, signing key first.
+func (ks *KeySet) JWKS() (*JWKSet, error) {
+	set := &JWKSet{Keys: make([]JWK, 0, len(ks.order))}
+	for _, kid := range ks.order {
+		jwk, err := ks.keys[kid].JWK()
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key used by the test vectors of RFC 4226 and
+// RFC 6238.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestHOTPRFC4226Vectors(t *testing.T) {
+	// RFC 4226, Appendix D
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	for counter, code := range want {
+		if got := hotp(rfcSecret, int64(counter), 6); got != code {
+			t.Errorf("hotp(counter=%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	// RFC 6238, Appendix B, SHA-1 rows
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		step := tt.unix / int64(TOTPPeriod.Seconds())
+		if got := hotp(rfcSecret, step, 8); got != tt.code {
+			t.Errorf("totp(T=%d) = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTPSkewWindow(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfcSecret)
+	now := time.Unix(1111111109, 0)
+	step := now.Unix() / int64(TOTPPeriod.Seconds())
+
+	tests := []struct {
+		name   string
+		offset int64
+		valid  bool
+	}{
+		{"current period", 0, true},
+		{"previous period", -1, true},
+		{"next period", 1, true},
+		{"two periods ago", -2, false},
+		{"two periods ahead", 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := hotp(rfcSecret, step+tt.offset, TOTPDigits)
+			matched, ok := ValidateTOTP(secret, code, now)
+			if ok != tt.valid {
+				t.Fatalf("ValidateTOTP() ok = %v, want %v", ok, tt.valid)
+			}
+			if ok && matched != step+tt.offset {
+				t.Errorf("ValidateTOTP() step = %d, want %d", matched, step+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfcSecret)
+	now := time.Unix(59, 0)
+	code := hotp(rfcSecret, 1, TOTPDigits)
+
+	if _, ok := ValidateTOTP(secret, code+"0", now); ok {
+		t.Error("accepted a code with too many digits")
+	}
+	if _, ok := ValidateTOTP("not base32!", code, now); ok {
+		t.Error("accepted a code for an undecodable secret")
+	}
+}
+
+// A code stays valid for the skew window, so callers refuse replays by the
+// step it matched, which must not move when the same code is sent again.
+func TestValidateTOTPStepReplay(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfcSecret)
+	first := time.Unix(1234567890, 0)
+	code := hotp(rfcSecret, first.Unix()/int64(TOTPPeriod.Seconds()), TOTPDigits)
+
+	lastUsed, ok := ValidateTOTP(secret, code, first)
+	if !ok {
+		t.Fatal("rejected a current code")
+	}
+
+	replayed, ok := ValidateTOTP(secret, code, first.Add(TOTPPeriod))
+	if !ok {
+		t.Fatal("rejected a code within the skew window")
+	}
+	if replayed > lastUsed {
+		t.Errorf("replayed code matched step %d, after the used step %d", replayed, lastUsed)
+	}
+
+	next := hotp(rfcSecret, lastUsed+1, TOTPDigits)
+	step, ok := ValidateTOTP(secret, next, first.Add(TOTPPeriod))
+	if !ok || step <= lastUsed {
+		t.Errorf("code of the next period matched step %d (ok %v), want one after %d", step, ok, lastUsed)
+	}
+}
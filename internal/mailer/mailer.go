@@ -1,16 +1,52 @@
 package mailer
 
-import "embed"
+import (
+	"embed"
+	"errors"
+)
 
 const (
-	FromName            = "Get Social With Go"
-	maxRetries          = 3
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	FromName              = "Get Social With Go"
+	UserWelcomeTemplate   = "user_invitation.tmpl"
+	PasswordResetTemplate = "password_reset.tmpl"
+	AccountUnlockTemplate = "account_unlock.tmpl"
+	NewFollowerTemplate   = "new_follower.tmpl"
 )
 
+// HasOneTimeLink reports whether emails of template carry a link that can
+// only be used once, such as an activation or password reset link.
+func HasOneTimeLink(template string) bool {
+	switch template {
+	case UserWelcomeTemplate, PasswordResetTemplate, AccountUnlockTemplate:
+		return true
+	}
+	return false
+}
+
 //go:embed templates/*
 var FS embed.FS
 
+// ErrRejected marks a message the provider refused for good, such as an
+// invalid recipient. Sending it again would fail the same way.
+var ErrRejected = errors.New("email rejected")
+
 type Client interface {
-	Send(templateFile, username, email string, data any, isSandbox bool) error
+	// Send renders templateFile in the best match for locale and delivers
+	// it with an HTML and a plain text part. A non-empty unsubscribeURL is
+	// announced in the List-Unsubscribe header as a one-click link. Send
+	// makes a single attempt; retrying is up to the caller, unless the
+	// error wraps ErrRejected.
+	Send(templateFile, locale, username, email string, data any, unsubscribeURL string, isSandbox bool) error
+}
+
+// listUnsubscribeHeaders lets mail clients offer an unsubscribe button that
+// POSTs to unsubscribeURL, as described in RFC 8058.
+func listUnsubscribeHeaders(unsubscribeURL string) map[string]string {
+	if unsubscribeURL == "" {
+		return nil
+	}
+	return map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
 }
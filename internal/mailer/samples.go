@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// samples holds made-up variables for every template, named after the
+// template with a .json extension. They feed the admin preview and the
+// golden tests, so they must contain every variable the template uses.
+//
+//go:embed samples/*.json
+var samples embed.FS
+
+// SampleData returns the sample variables of a template, decoded the same
+// way the outbox decodes queued variables before rendering.
+func SampleData(name string) (map[string]any, error) {
+	file := "samples/" + strings.TrimSuffix(name, ".tmpl") + ".json"
+	raw, err := samples.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w %s", ErrUnknownTemplate, name)
+		}
+		return nil, err
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode sample data of %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// RenderSample renders a template with its sample data.
+func (t *Templates) RenderSample(name, locale string) (*Message, error) {
+	data, err := SampleData(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.Render(name, locale, data)
+}
@@ -1,71 +1,70 @@
 package mailer
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"log"
-	"text/template"
+	"net/http"
 	"time"
 
 	sendGridGo "github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
+const sendGridTimeout = 10 * time.Second
+
 type SendGridMailer struct {
 	fromEmail string
 	apiKey    string
 	client    *sendGridGo.Client
+	templates *Templates
 }
 
-func NewSendGridMailer(fromEmail, apiKey string) *SendGridMailer {
+func NewSendGridMailer(fromEmail, apiKey string, templates *Templates) *SendGridMailer {
 	client := sendGridGo.NewSendClient(apiKey)
 	return &SendGridMailer{
 		fromEmail: fromEmail,
 		apiKey:    apiKey,
 		client:    client,
+		templates: templates,
 	}
 }
 
-func (sg *SendGridMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
+func (sg *SendGridMailer) Send(templateFile, locale, username, email string, data any, unsubscribeURL string, isSandbox bool) error {
 	from := mail.NewEmail(FromName, sg.fromEmail)
 	to := mail.NewEmail(username, email)
 
-	//template parsing and building
-
-	tmpl, err := template.ParseFiles("templates/" + templateFile)
-	if err != nil {
-		return fmt.Errorf("failed to parse template file %s: %v", templateFile, err)
-	}
-
-	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	rendered, err := sg.templates.Render(templateFile, locale, data)
 	if err != nil {
-		return fmt.Errorf("failed to execute subject template for %s: %v", email, err)
+		return err
 	}
 
-	body := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(body, "body", data)
-	if err != nil {
-		return fmt.Errorf("failed to execute body template for %s: %v", email, err)
+	message := mail.NewSingleEmail(from, rendered.Subject, to, rendered.Text, rendered.HTML)
+	for key, value := range listUnsubscribeHeaders(unsubscribeURL) {
+		message.SetHeader(key, value)
 	}
 
-	message := mail.NewSingleEmail(from, subject.String(), to, "", body.String())
-
 	//sandbox mode == dev
 	message.SetMailSettings(&mail.MailSettings{
 		SandboxMode: &mail.Setting{
 			Enable: &isSandbox,
 		},
 	})
-	var retryErr error
-	for i := 0; i < maxRetries; i++ {
-		response, retryErr := sg.client.Send(message)
-		if retryErr != nil {
-			time.Sleep(time.Second * time.Duration(i+1))
-			continue
-		}
-		log.Printf("email sent to %s with status code %d", email, response.StatusCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendGridTimeout)
+	defer cancel()
+
+	response, err := sg.client.SendWithContext(ctx, message)
+	if err != nil {
+		return err
+	}
+	// the client only fails on transport errors, SendGrid reports a
+	// refused message in the status code
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
 		return nil
+	case response.StatusCode >= 400 && response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: sendgrid answered %d: %s", ErrRejected, response.StatusCode, response.Body)
+	default:
+		return fmt.Errorf("sendgrid answered %d: %s", response.StatusCode, response.Body)
 	}
-	return fmt.Errorf("failed to send email to %s after %d attempts: %v", email, maxRetries, retryErr)
 }
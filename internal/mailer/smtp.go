@@ -0,0 +1,190 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// TLS modes of an SMTP connection.
+const (
+	SMTPTLSNone     = "none"
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSImplicit = "tls"
+)
+
+const smtpTimeout = 10 * time.Second
+
+type SMTPConfig struct {
+	Host string
+	Port int
+	// Username and Password are only used when Username is set.
+	Username string
+	Password string
+	// TLSMode is one of the SMTPTLS constants.
+	TLSMode string
+}
+
+// SMTPMailer delivers through any SMTP server, such as a local mail catcher
+// in development. SMTP has no sandbox, so every message is delivered.
+type SMTPMailer struct {
+	fromEmail string
+	cfg       SMTPConfig
+	templates *Templates
+}
+
+func NewSMTPMailer(fromEmail string, cfg SMTPConfig, templates *Templates) (*SMTPMailer, error) {
+	switch cfg.TLSMode {
+	case SMTPTLSNone, SMTPTLSStartTLS, SMTPTLSImplicit:
+	default:
+		return nil, fmt.Errorf("unknown SMTP TLS mode %q", cfg.TLSMode)
+	}
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("SMTP host is not set")
+	}
+	return &SMTPMailer{fromEmail: fromEmail, cfg: cfg, templates: templates}, nil
+}
+
+func (m *SMTPMailer) Send(templateFile, locale, username, email string, data any, unsubscribeURL string, isSandbox bool) error {
+	rendered, err := m.templates.Render(templateFile, locale, data)
+	if err != nil {
+		return err
+	}
+	message, err := m.message(username, email, rendered, unsubscribeURL)
+	if err != nil {
+		return err
+	}
+
+	err = m.deliver(email, message)
+	// 5xx replies are permanent failures, 4xx ones are worth another try
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return fmt.Errorf("%w: %w", ErrRejected, err)
+	}
+	return err
+}
+
+// message builds a multipart/alternative message, plain text first so
+// clients that can show HTML prefer the last part.
+func (m *SMTPMailer) message(username, email string, rendered *Message, unsubscribeURL string) ([]byte, error) {
+	from := mail.Address{Name: FromName, Address: m.fromEmail}
+	to := mail.Address{Name: username, Address: email}
+
+	msg := new(bytes.Buffer)
+	parts := multipart.NewWriter(msg)
+	fmt.Fprintf(msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(msg, "To: %s\r\n", to.String())
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", rendered.Subject))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	headers := listUnsubscribeHeaders(unsubscribeURL)
+	for _, key := range slices.Sorted(maps.Keys(headers)) {
+		fmt.Fprintf(msg, "%s: %s\r\n", key, headers[key])
+	}
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(msg, "Content-Type: multipart/alternative; boundary=%q\r\n", parts.Boundary())
+	msg.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", rendered.Text},
+		{"text/html; charset=UTF-8", rendered.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+func (m *SMTPMailer) deliver(email string, message []byte) error {
+	client, err := m.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if m.cfg.Username != "" {
+		auth := smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.fromEmail); err != nil {
+		return err
+	}
+	if err := client.Rcpt(email); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// dial connects and, depending on the TLS mode, secures the connection
+// before anything is sent over it.
+func (m *SMTPMailer) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+
+	var conn net.Conn
+	var err error
+	if m.cfg.TLSMode == SMTPTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if m.cfg.TLSMode == SMTPTLSStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
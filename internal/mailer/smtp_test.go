@@ -0,0 +1,166 @@
+package mailer
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// smtpServer accepts a single message on a local port, the way a mail
+// catcher would, and hands its recipient and content to the test.
+type smtpServer struct {
+	addr     *net.TCPAddr
+	rcpt     chan string
+	messages chan string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &smtpServer{
+		addr:     l.Addr().(*net.TCPAddr),
+		rcpt:     make(chan string, 1),
+		messages: make(chan string, 1),
+	}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.serve(textproto.NewConn(conn))
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn *textproto.Conn) {
+	conn.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			conn.PrintfLine("250 localhost")
+		case "RCPT":
+			s.rcpt <- arg
+			conn.PrintfLine("250 OK")
+		case "DATA":
+			conn.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(conn.DotReader())
+			if err != nil {
+				return
+			}
+			s.messages <- string(data)
+			conn.PrintfLine("250 OK")
+		case "QUIT":
+			conn.PrintfLine("221 bye")
+			return
+		default:
+			conn.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	templates, err := LoadTemplates(FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newSMTPServer(t)
+	m, err := NewSMTPMailer("noreply@example.com", SMTPConfig{
+		Host:    server.addr.IP.String(),
+		Port:    server.addr.Port,
+		TLSMode: SMTPTLSNone,
+	}, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := SampleData(UserWelcomeTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsubscribeURL := "https://api.example.com/v1/notifications/unsubscribe/token"
+	if err := m.Send(UserWelcomeTemplate, "es", "gopher", "gopher@example.com", data, unsubscribeURL, false); err != nil {
+		t.Fatal(err)
+	}
+	want, err := templates.Render(UserWelcomeTemplate, "es", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rcpt := <-server.rcpt; rcpt != "TO:<gopher@example.com>" {
+		t.Errorf("RCPT %s, want TO:<gopher@example.com>", rcpt)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(<-server.messages))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{
+		"From":                  `"Get Social With Go" <noreply@example.com>`,
+		"To":                    `"gopher" <gopher@example.com>`,
+		"Subject":               want.Subject,
+		"MIME-Version":          "1.0",
+		"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+	for key, value := range headers {
+		got := msg.Header.Get(key)
+		if key == "Subject" {
+			got = subject
+		}
+		if got != value {
+			t.Errorf("%s header %q, want %q", key, got, value)
+		}
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("content type %s, want multipart/alternative", mediaType)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for _, wantPart := range []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", want.Text},
+		{"text/html; charset=UTF-8", want.HTML},
+	} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := part.Header.Get("Content-Type"); got != wantPart.contentType {
+			t.Errorf("part of type %s, want %s", got, wantPart.contentType)
+		}
+		// NextPart already decoded the quoted-printable body
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != wantPart.body {
+			t.Errorf("%s part:\n%s\nwant:\n%s", wantPart.contentType, body, wantPart.body)
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("message has more than two parts")
+	}
+}
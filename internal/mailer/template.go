@@ -0,0 +1,186 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultLocale is the language every template exists in, used whenever a
+// user's language has no translation.
+const DefaultLocale = "en"
+
+// Registered lists every template the API sends. Each of them must exist in
+// DefaultLocale.
+var Registered = []string{UserWelcomeTemplate, PasswordResetTemplate, AccountUnlockTemplate, NewFollowerTemplate}
+
+// ErrUnknownTemplate is returned when rendering a template that does not exist.
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// blocks every email template has to define
+var requiredBlocks = []string{"subject", "html", "text"}
+
+// Message is a rendered email. HTML and Text carry the same content, mail
+// clients pick whichever they can show.
+type Message struct {
+	// Locale is the locale the template was rendered in, which is not the
+	// one asked for when it has no translation.
+	Locale  string `json:"locale"`
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+type emailTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// Templates renders the emails under templates/. Every locale has a
+// directory named after its language tag holding the email templates and a
+// partials/ directory. Layouts in layouts/ are shared by every locale, and
+// partials a locale does not translate fall back to those of DefaultLocale.
+//
+// Each email template defines a "subject", an "html" and a "text" block. The
+// html block is rendered with html/template, so data is escaped; subject and
+// text are rendered as plain text.
+type Templates struct {
+	locales map[string]map[string]*emailTemplate
+}
+
+// LoadTemplates parses every template in fsys and checks that each defines
+// the required blocks and that every registered template has a DefaultLocale
+// version, so a broken template stops the API at startup rather than at the
+// first send.
+func LoadTemplates(fsys fs.FS) (*Templates, error) {
+	root, err := fs.Sub(fsys, "templates")
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(root, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{locales: make(map[string]map[string]*emailTemplate)}
+	var errs []error
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == "layouts" {
+			continue
+		}
+		locale := entry.Name()
+
+		files, err := fs.Glob(root, locale+"/*.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		t.locales[locale] = make(map[string]*emailTemplate, len(files))
+		for _, file := range files {
+			tmpl, err := parseEmailTemplate(root, locale, file)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			t.locales[locale][path.Base(file)] = tmpl
+		}
+	}
+
+	for _, name := range Registered {
+		if _, ok := t.locales[DefaultLocale][name]; !ok {
+			errs = append(errs, fmt.Errorf("template %s is missing for the default locale %s", name, DefaultLocale))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return t, nil
+}
+
+func parseEmailTemplate(root fs.FS, locale, file string) (*emailTemplate, error) {
+	shared := []string{"layouts/*.tmpl", DefaultLocale + "/partials/*.tmpl"}
+	if locale != DefaultLocale {
+		// parsed last, so the locale's own partials replace the default ones
+		shared = append(shared, locale+"/partials/*.tmpl")
+	}
+
+	var patterns []string
+	for _, pattern := range shared {
+		// ParseFS fails on a pattern without matches
+		if matches, _ := fs.Glob(root, pattern); len(matches) > 0 {
+			patterns = append(patterns, pattern)
+		}
+	}
+	patterns = append(patterns, file)
+
+	html, err := htmltemplate.ParseFS(root, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", file, err)
+	}
+	text, err := texttemplate.ParseFS(root, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", file, err)
+	}
+
+	for _, block := range requiredBlocks {
+		if text.Lookup(block) == nil {
+			return nil, fmt.Errorf("template %s does not define %q", file, block)
+		}
+	}
+	return &emailTemplate{html: html, text: text}, nil
+}
+
+// Render renders a template in the best match for locale: the exact tag,
+// then its base language, then DefaultLocale.
+func (t *Templates) Render(name, locale string, data any) (*Message, error) {
+	tmpl, locale, ok := t.lookup(name, locale)
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownTemplate, name)
+	}
+
+	subject := new(bytes.Buffer)
+	if err := tmpl.text.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to execute subject template of %s: %w", name, err)
+	}
+	html := new(bytes.Buffer)
+	if err := tmpl.html.ExecuteTemplate(html, "html", data); err != nil {
+		return nil, fmt.Errorf("failed to execute html template of %s: %w", name, err)
+	}
+	text := new(bytes.Buffer)
+	if err := tmpl.text.ExecuteTemplate(text, "text", data); err != nil {
+		return nil, fmt.Errorf("failed to execute text template of %s: %w", name, err)
+	}
+
+	return &Message{
+		Locale:  locale,
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    strings.TrimSpace(html.String()) + "\n",
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}, nil
+}
+
+func (t *Templates) lookup(name, locale string) (*emailTemplate, string, bool) {
+	locale = strings.ToLower(locale)
+	base, _, _ := strings.Cut(locale, "-")
+	for _, candidate := range []string{locale, base, DefaultLocale} {
+		if tmpl, ok := t.locales[candidate][name]; ok {
+			return tmpl, candidate, true
+		}
+	}
+	return nil, "", false
+}
+
+// Locales returns the locales templates exist in, sorted.
+func (t *Templates) Locales() []string {
+	locales := make([]string, 0, len(t.locales))
+	for locale := range t.locales {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
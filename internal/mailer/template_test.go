@@ -0,0 +1,88 @@
+package mailer
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// TestTemplatesGolden renders every template of every locale in FS with its
+// sample data and compares the result to testdata/golden, so template changes
+// show up in review as a diff of what users receive. After an intended
+// change, refresh the golden files with
+//
+//	go test ./internal/mailer -run TestTemplatesGolden -update
+func TestTemplatesGolden(t *testing.T) {
+	templates, err := LoadTemplates(FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for locale, names := range templates.locales {
+		for name := range names {
+			t.Run(locale+"/"+name, func(t *testing.T) {
+				msg, err := templates.RenderSample(name, locale)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if msg.Locale != locale {
+					t.Fatalf("rendered in %s, want %s", msg.Locale, locale)
+				}
+
+				// text/template writes this for a variable missing from the data
+				if strings.Contains(msg.Subject+msg.Text, "<no value>") {
+					t.Fatalf("%s uses a variable its sample data lacks", name)
+				}
+
+				got := fmt.Sprintf("Subject: %s\n\n--- html ---\n%s\n--- text ---\n%s", msg.Subject, msg.HTML, msg.Text)
+				golden := filepath.Join("testdata", "golden", locale, strings.TrimSuffix(name, ".tmpl")+".golden")
+				if *update {
+					if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("%v, run with -update to create it", err)
+				}
+				if got != string(want) {
+					t.Errorf("%s differs from %s, run with -update if the change is intended\n got:\n%s", name, golden, got)
+				}
+			})
+		}
+	}
+}
+
+// TestTemplatesFallback checks that a locale without a translation gets the
+// nearest one.
+func TestTemplatesFallback(t *testing.T) {
+	templates, err := LoadTemplates(FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for locale, want := range map[string]string{
+		"":      DefaultLocale,
+		"en-GB": "en",
+		"es-MX": "es",
+		"ES":    "es",
+		"fr":    DefaultLocale,
+	} {
+		msg, err := templates.RenderSample(UserWelcomeTemplate, locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Locale != want {
+			t.Errorf("locale %q rendered in %s, want %s", locale, msg.Locale, want)
+		}
+	}
+}
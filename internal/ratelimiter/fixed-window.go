@@ -5,40 +5,61 @@ import (
 	"time"
 )
 
+type fixedWindow struct {
+	count int
+	start time.Time
+}
+
+// FixedWindowRateLimiter counts requests per client in windows starting at
+// the client's first request. It is cheap but lets a client burst up to
+// twice the limit across a window boundary.
 type FixedWindowRateLimiter struct {
-	sync.RWMutex
-	clients map[string]int
+	*janitor
+	sync.Mutex
+	clients map[string]*fixedWindow
 	limit   int
 	window  time.Duration
+	// now is time.Now, tests swap in their own clock
+	now func() time.Time
 }
 
-func NewFixedWindowRateLimiter(limit int, window time.Duration) *FixedWindowRateLimiter {
-	return &FixedWindowRateLimiter{
-		clients: make(map[string]int),
+func NewFixedWindowRateLimiter(limit int, window, janitorInterval time.Duration) *FixedWindowRateLimiter {
+	rl := &FixedWindowRateLimiter{
+		clients: make(map[string]*fixedWindow),
 		limit:   limit,
 		window:  window,
+		now:     time.Now,
 	}
+	rl.janitor = startJanitor(janitorInterval, rl.evict)
+	return rl
 }
 
-func (rl *FixedWindowRateLimiter) Allow(ip string) (bool, time.Duration) {
-	rl.RLock()
-	count, exists := rl.clients[ip]
-	rl.RUnlock()
-	if !exists || count < rl.limit {
-		rl.Lock()
-		if !exists {
-			go rl.resetCount(ip)
-		}
-		rl.clients[ip]++
-		rl.Unlock()
-		return true, 0
+func (rl *FixedWindowRateLimiter) Allow(key string) Result {
+	now := rl.now()
+
+	rl.Lock()
+	defer rl.Unlock()
+
+	client, exists := rl.clients[key]
+	if !exists || now.Sub(client.start) >= rl.window {
+		client = &fixedWindow{start: now}
+		rl.clients[key] = client
+	}
+
+	reset := client.start.Add(rl.window).Sub(now)
+	if client.count >= rl.limit {
+		return Result{Limit: rl.limit, Reset: reset, RetryAfter: reset}
 	}
-	return false, rl.window
+	client.count++
+	return Result{Allowed: true, Limit: rl.limit, Remaining: rl.limit - client.count, Reset: reset}
 }
 
-func (rl *FixedWindowRateLimiter) resetCount(ip string) {
-	time.Sleep(rl.window)
+func (rl *FixedWindowRateLimiter) evict(now time.Time) {
 	rl.Lock()
-	delete(rl.clients, ip)
-	rl.Unlock()
+	defer rl.Unlock()
+	for key, client := range rl.clients {
+		if now.Sub(client.start) >= rl.window {
+			delete(rl.clients, key)
+		}
+	}
 }
@@ -1,13 +1,177 @@
 package ratelimiter
 
-import "time"
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
 
 type Limiter interface {
-	Allow(ip string) (bool, time.Duration)
+	Allow(key string) Result
+}
+
+// Result is the state of a client's limit once a request has been counted.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the client has its full limit again.
+	Reset time.Duration
+	// RetryAfter is how long a rejected client has to wait for its next
+	// request to be allowed.
+	RetryAfter time.Duration
 }
 
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+)
+
+const (
+	StrategyFixedWindow   = "fixed-window"
+	StrategySlidingWindow = "sliding-window"
+	StrategyTokenBucket   = "token-bucket"
+)
+
 type Config struct {
 	RequestsPerTimeFrame int
 	TimeFrame            time.Duration
 	Enabled              bool
+	// Strategy picks the algorithm, one of the Strategy constants. Empty
+	// means fixed window.
+	Strategy string
+	// JanitorInterval is how often idle clients are evicted. Zero means once
+	// per TimeFrame.
+	JanitorInterval time.Duration
+	// Store is where counters live, one of the Store constants. Empty means
+	// memory. The redis store always counts in fixed windows and uses
+	// Strategy only for its local fallback.
+	Store string
+	// FallbackCooldown is how long the redis store keeps limiting locally
+	// after Redis failed, before trying it again.
+	FallbackCooldown time.Duration
+	// Policies are named limits for groups of routes, each counted
+	// separately from the default limit above.
+	Policies map[string]Policy
+	// Logger reports the redis store switching to its fallback and back.
+	// Nil discards those messages.
+	Logger *zap.SugaredLogger
+}
+
+// DefaultPolicy is the name of the limit taken from the top level of Config.
+const DefaultPolicy = "default"
+
+// Policy is a limit for a group of routes.
+type Policy struct {
+	RequestsPerTimeFrame int
+	TimeFrame            time.Duration
+}
+
+// NewPolicies builds one limiter for DefaultPolicy, from the top level limit
+// of cfg, and one for each of cfg.Policies.
+func NewPolicies(cfg Config, rdb *redis.Client) (map[string]Limiter, error) {
+	policies := map[string]Policy{
+		DefaultPolicy: {RequestsPerTimeFrame: cfg.RequestsPerTimeFrame, TimeFrame: cfg.TimeFrame},
+	}
+	for name, policy := range cfg.Policies {
+		policies[name] = policy
+	}
+
+	limiters := make(map[string]Limiter, len(policies))
+	for name, policy := range policies {
+		policyCfg := cfg
+		policyCfg.RequestsPerTimeFrame = policy.RequestsPerTimeFrame
+		policyCfg.TimeFrame = policy.TimeFrame
+
+		limiter, err := newLimiter(policyCfg, name, rdb)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit policy %s: %w", name, err)
+		}
+		limiters[name] = limiter
+	}
+	return limiters, nil
+}
+
+// New builds the limiter selected by cfg. rdb is only used, and required, by
+// the redis store.
+func New(cfg Config, rdb *redis.Client) (Limiter, error) {
+	return newLimiter(cfg, DefaultPolicy, rdb)
+}
+
+func newLimiter(cfg Config, name string, rdb *redis.Client) (Limiter, error) {
+	if cfg.RequestsPerTimeFrame < 1 {
+		return nil, fmt.Errorf("rate limit must allow at least 1 request, got %d", cfg.RequestsPerTimeFrame)
+	}
+	if cfg.TimeFrame <= 0 {
+		return nil, fmt.Errorf("rate limit time frame must be positive, got %s", cfg.TimeFrame)
+	}
+
+	local, err := newLocal(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Store {
+	case "", StoreMemory:
+		return local, nil
+	case StoreRedis:
+		if rdb == nil {
+			return nil, fmt.Errorf("the redis rate limiter store needs redis to be enabled")
+		}
+		return NewRedisRateLimiter(rdb, name, cfg.RequestsPerTimeFrame, cfg.TimeFrame, local, cfg.FallbackCooldown, cfg.Logger), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limiter store %q", cfg.Store)
+	}
+}
+
+func newLocal(cfg Config) (Limiter, error) {
+	interval := cfg.JanitorInterval
+	if interval <= 0 {
+		interval = cfg.TimeFrame
+	}
+
+	switch cfg.Strategy {
+	case "", StrategyFixedWindow:
+		return NewFixedWindowRateLimiter(cfg.RequestsPerTimeFrame, cfg.TimeFrame, interval), nil
+	case StrategySlidingWindow:
+		return NewSlidingWindowRateLimiter(cfg.RequestsPerTimeFrame, cfg.TimeFrame, interval), nil
+	case StrategyTokenBucket:
+		return NewTokenBucketRateLimiter(cfg.RequestsPerTimeFrame, cfg.TimeFrame, interval), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limiter strategy %q", cfg.Strategy)
+	}
+}
+
+// janitor evicts idle clients from an in-memory limiter. A single goroutine
+// serves every client, so the goroutine count stays flat however many
+// distinct IPs show up.
+type janitor struct {
+	stop chan struct{}
+	once sync.Once
+}
+
+func startJanitor(interval time.Duration, sweep func(now time.Time)) *janitor {
+	j := &janitor{stop: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.stop:
+				return
+			case now := <-ticker.C:
+				sweep(now)
+			}
+		}
+	}()
+	return j
+}
+
+// Stop ends the janitor goroutine. The limiter keeps working, it just no
+// longer forgets idle clients.
+func (j *janitor) Stop() {
+	j.once.Do(func() { close(j.stop) })
 }
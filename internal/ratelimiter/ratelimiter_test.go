@@ -0,0 +1,237 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// BenchmarkLimiters compares the strategies with traffic spread over many
+// distinct client IPs, which is what stresses the client maps and eviction.
+func BenchmarkLimiters(b *testing.B) {
+	strategies := []string{StrategyFixedWindow, StrategySlidingWindow, StrategyTokenBucket}
+
+	for _, clients := range []int{1_000, 100_000} {
+		ips := make([]string, clients)
+		for i := range ips {
+			ips[i] = fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+		}
+
+		for _, strategy := range strategies {
+			b.Run(fmt.Sprintf("%s/ips=%d", strategy, clients), func(b *testing.B) {
+				limiter, err := New(Config{
+					RequestsPerTimeFrame: 20,
+					TimeFrame:            5 * time.Second,
+					Strategy:             strategy,
+					JanitorInterval:      100 * time.Millisecond,
+				}, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer limiter.(interface{ Stop() }).Stop()
+
+				var next atomic.Uint64
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						limiter.Allow(ips[next.Add(1)%uint64(len(ips))])
+					}
+				})
+			})
+		}
+	}
+}
+
+// fakeClock is a clock tests move by hand. It starts on a whole minute, so
+// windows truncated to a few seconds start exactly at it.
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// step is one request in a limiter test, made after advancing the clock.
+type step struct {
+	advance    time.Duration
+	allowed    bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+func runSteps(t *testing.T, limiter Limiter, clock *fakeClock, steps []step) {
+	t.Helper()
+	for i, s := range steps {
+		clock.Advance(s.advance)
+		got := limiter.Allow("client")
+		if got.Allowed != s.allowed || got.Remaining != s.remaining || got.Reset != s.reset || got.RetryAfter != s.retryAfter {
+			t.Errorf("request %d: got allowed=%v remaining=%d reset=%s retryAfter=%s, want allowed=%v remaining=%d reset=%s retryAfter=%s",
+				i, got.Allowed, got.Remaining, got.Reset, got.RetryAfter, s.allowed, s.remaining, s.reset, s.retryAfter)
+		}
+	}
+}
+
+func TestFixedWindow(t *testing.T) {
+	clock := newFakeClock()
+	rl := NewFixedWindowRateLimiter(3, 10*time.Second, time.Hour)
+	defer rl.Stop()
+	rl.now = clock.Now
+
+	runSteps(t, rl, clock, []step{
+		{allowed: true, remaining: 2, reset: 10 * time.Second},
+		{advance: time.Second, allowed: true, remaining: 1, reset: 9 * time.Second},
+		{advance: time.Second, allowed: true, remaining: 0, reset: 8 * time.Second},
+		{advance: time.Second, allowed: false, remaining: 0, reset: 7 * time.Second, retryAfter: 7 * time.Second},
+		// a new window starts with the first request after the old one ended
+		{advance: 7 * time.Second, allowed: true, remaining: 2, reset: 10 * time.Second},
+	})
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clock := newFakeClock()
+	rl := NewSlidingWindowRateLimiter(10, 10*time.Second, time.Hour)
+	defer rl.Stop()
+	rl.now = clock.Now
+
+	steps := make([]step, 0, 20)
+	for i := range 10 {
+		steps = append(steps, step{allowed: true, remaining: 9 - i, reset: 20 * time.Second})
+	}
+	steps = append(steps,
+		// the current window is full on its own, so it has to become the
+		// previous one, and the full limit only returns once it decayed
+		// completely
+		step{allowed: false, reset: 20 * time.Second, retryAfter: 10*time.Second + time.Millisecond},
+		// halfway through the next window the previous one weighs 5
+		step{advance: 15 * time.Second, allowed: true, remaining: 4, reset: 15 * time.Second},
+	)
+	for i := range 4 {
+		steps = append(steps, step{allowed: true, remaining: 3 - i, reset: 15 * time.Second})
+	}
+	steps = append(steps,
+		// 5 weighted plus 5 current: the weight has to drop by a hair
+		step{allowed: false, reset: 15 * time.Second, retryAfter: time.Millisecond},
+		step{advance: time.Second, allowed: true, remaining: 0, reset: 14 * time.Second},
+	)
+	runSteps(t, rl, clock, steps)
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := newFakeClock()
+	// one token per second
+	rl := NewTokenBucketRateLimiter(4, 4*time.Second, time.Hour)
+	defer rl.Stop()
+	rl.now = clock.Now
+
+	runSteps(t, rl, clock, []step{
+		{allowed: true, remaining: 3, reset: time.Second},
+		{allowed: true, remaining: 2, reset: 2 * time.Second},
+		{allowed: true, remaining: 1, reset: 3 * time.Second},
+		{allowed: true, remaining: 0, reset: 4 * time.Second},
+		{allowed: false, reset: 4 * time.Second, retryAfter: time.Second},
+		{advance: 500 * time.Millisecond, allowed: false, reset: 3500 * time.Millisecond, retryAfter: 500 * time.Millisecond},
+		{advance: 500 * time.Millisecond, allowed: true, remaining: 0, reset: 4 * time.Second},
+		// the bucket never holds more than its size
+		{advance: time.Hour, allowed: true, remaining: 3, reset: time.Second},
+	})
+}
+
+func TestEvict(t *testing.T) {
+	const window = 10 * time.Second
+
+	tests := []struct {
+		name string
+		new  func() (Limiter, *janitor, func(now time.Time), func() int, *fakeClock)
+		// idle time after which a client is forgotten
+		idle time.Duration
+	}{
+		{
+			name: StrategyFixedWindow,
+			new: func() (Limiter, *janitor, func(time.Time), func() int, *fakeClock) {
+				clock := newFakeClock()
+				rl := NewFixedWindowRateLimiter(1, window, time.Hour)
+				rl.now = clock.Now
+				return rl, rl.janitor, rl.evict, func() int { return len(rl.clients) }, clock
+			},
+			idle: window,
+		},
+		{
+			name: StrategySlidingWindow,
+			new: func() (Limiter, *janitor, func(time.Time), func() int, *fakeClock) {
+				clock := newFakeClock()
+				rl := NewSlidingWindowRateLimiter(1, window, time.Hour)
+				rl.now = clock.Now
+				return rl, rl.janitor, rl.evict, func() int { return len(rl.clients) }, clock
+			},
+			idle: 2 * window,
+		},
+		{
+			name: StrategyTokenBucket,
+			new: func() (Limiter, *janitor, func(time.Time), func() int, *fakeClock) {
+				clock := newFakeClock()
+				rl := NewTokenBucketRateLimiter(1, window, time.Hour)
+				rl.now = clock.Now
+				return rl, rl.janitor, rl.evict, func() int { return len(rl.clients) }, clock
+			},
+			idle: window,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, j, evict, clients, clock := tt.new()
+			defer j.Stop()
+
+			limiter.Allow("client")
+			evict(clock.Now().Add(tt.idle - time.Nanosecond))
+			if clients() != 1 {
+				t.Fatalf("client evicted before being idle for %s", tt.idle)
+			}
+			evict(clock.Now().Add(tt.idle))
+			if clients() != 0 {
+				t.Fatalf("client kept after being idle for %s", tt.idle)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		window time.Duration
+	}{
+		{"zero requests", 0, time.Second},
+		{"negative requests", -1, time.Second},
+		{"zero window", 1, 0},
+		{"negative window", 1, -time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, strategy := range []string{StrategyFixedWindow, StrategySlidingWindow, StrategyTokenBucket} {
+				_, err := New(Config{RequestsPerTimeFrame: tt.limit, TimeFrame: tt.window, Strategy: strategy}, nil)
+				if err == nil {
+					t.Errorf("%s: New accepted %d requests per %s", strategy, tt.limit, tt.window)
+				}
+			}
+
+			_, err := NewPolicies(Config{
+				RequestsPerTimeFrame: 10,
+				TimeFrame:            time.Second,
+				Policies:             map[string]Policy{"broken": {RequestsPerTimeFrame: tt.limit, TimeFrame: tt.window}},
+			}, nil)
+			if err == nil {
+				t.Errorf("NewPolicies accepted %d requests per %s", tt.limit, tt.window)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	redisKeyPrefix = "ratelimit:"
+	redisTimeout   = 100 * time.Millisecond
+)
+
+// fixedWindowScript counts a request against KEYS[1] and starts its window
+// of ARGV[1] milliseconds on the first one. Running it as a script keeps the
+// increment and the expiry atomic, so a key can never be left without a TTL.
+var fixedWindowScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	ttl = tonumber(ARGV[1])
+end
+return {count, ttl}
+`)
+
+// RedisRateLimiter is a fixed window limiter whose counters live in Redis,
+// so every replica of the API shares the same limit per client. When Redis
+// cannot be reached it falls back to a local limiter and keeps using it for
+// the cooldown before trying Redis again, instead of paying a timeout on
+// every request.
+type RedisRateLimiter struct {
+	rdb *redis.Client
+	// keeps the counters of each policy apart
+	prefix   string
+	limit    int
+	window   time.Duration
+	fallback Limiter
+	cooldown time.Duration
+	logger   *zap.SugaredLogger
+
+	// unix nanoseconds until which Redis is skipped
+	degradedUntil atomic.Int64
+	// whether the last attempt to use Redis failed, so switching to and
+	// from the fallback is logged once
+	degraded atomic.Bool
+	failures atomic.Int64
+}
+
+// NewRedisRateLimiter builds a limiter for one policy. logger may be nil.
+func NewRedisRateLimiter(rdb *redis.Client, policy string, limit int, window time.Duration, fallback Limiter, cooldown time.Duration, logger *zap.SugaredLogger) *RedisRateLimiter {
+	if logger == nil {
+		logger = zap.NewNop().Sugar()
+	}
+	return &RedisRateLimiter{
+		rdb:      rdb,
+		prefix:   redisKeyPrefix + policy + ":",
+		limit:    limit,
+		window:   window,
+		fallback: fallback,
+		cooldown: cooldown,
+		logger:   logger.With("policy", policy),
+	}
+}
+
+func (rl *RedisRateLimiter) Allow(key string) Result {
+	now := time.Now()
+	if now.UnixNano() < rl.degradedUntil.Load() {
+		return rl.fallback.Allow(key)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	res, err := fixedWindowScript.Run(ctx, rl.rdb, []string{rl.prefix + key}, rl.window.Milliseconds()).Int64Slice()
+	if err == nil && len(res) != 2 {
+		err = fmt.Errorf("unexpected rate limit script reply %v", res)
+	}
+	if err != nil {
+		rl.failures.Add(1)
+		rl.degradedUntil.Store(now.Add(rl.cooldown).UnixNano())
+		if rl.degraded.CompareAndSwap(false, true) {
+			rl.logger.Warnw("redis rate limiter unavailable, limiting locally", "error", err, "cooldown", rl.cooldown)
+		}
+		return rl.fallback.Allow(key)
+	}
+	if rl.degraded.CompareAndSwap(true, false) {
+		rl.logger.Infow("redis rate limiter recovered")
+	}
+
+	count, ttl := res[0], time.Duration(res[1])*time.Millisecond
+	if count > int64(rl.limit) {
+		return Result{Limit: rl.limit, Reset: ttl, RetryAfter: ttl}
+	}
+	return Result{Allowed: true, Limit: rl.limit, Remaining: rl.limit - int(count), Reset: ttl}
+}
+
+// Failures returns how many times Redis could not be used and the local
+// limiter took over.
+func (rl *RedisRateLimiter) Failures() int64 {
+	return rl.failures.Load()
+}
+
+// Stop ends the janitor of the local fallback.
+func (rl *RedisRateLimiter) Stop() {
+	if j, ok := rl.fallback.(interface{ Stop() }); ok {
+		j.Stop()
+	}
+}
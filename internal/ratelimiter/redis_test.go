@@ -0,0 +1,102 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// countingLimiter stands in for the local fallback and counts its requests.
+type countingLimiter struct {
+	calls int
+}
+
+func (l *countingLimiter) Allow(key string) Result {
+	l.calls++
+	return Result{Allowed: true, Limit: 1}
+}
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { rdb.Close() })
+	return mr, rdb
+}
+
+func TestRedisRateLimiter(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	fallback := &countingLimiter{}
+	rl := NewRedisRateLimiter(rdb, "auth", 2, 10*time.Second, fallback, time.Minute, nil)
+
+	want := []Result{
+		{Allowed: true, Limit: 2, Remaining: 1, Reset: 10 * time.Second},
+		{Allowed: true, Limit: 2, Remaining: 0, Reset: 10 * time.Second},
+		{Allowed: false, Limit: 2, Reset: 10 * time.Second, RetryAfter: 10 * time.Second},
+	}
+	for i, w := range want {
+		if got := rl.Allow("ip:10.0.0.1"); got != w {
+			t.Fatalf("request %d: got %+v, want %+v", i, got, w)
+		}
+	}
+	if !mr.Exists("ratelimit:auth:ip:10.0.0.1") {
+		t.Fatal("counter is not kept under the policy prefix")
+	}
+	if ttl := mr.TTL("ratelimit:auth:ip:10.0.0.1"); ttl != 10*time.Second {
+		t.Fatalf("counter expires in %s, want 10s", ttl)
+	}
+
+	// other clients have their own counter
+	if got := rl.Allow("ip:10.0.0.2"); !got.Allowed || got.Remaining != 1 {
+		t.Fatalf("second client: got %+v", got)
+	}
+
+	mr.FastForward(10 * time.Second)
+	if got := rl.Allow("ip:10.0.0.1"); !got.Allowed || got.Remaining != 1 {
+		t.Fatalf("after the window: got %+v", got)
+	}
+	if fallback.calls != 0 || rl.Failures() != 0 {
+		t.Fatalf("fallback used %d times with %d failures while redis was up", fallback.calls, rl.Failures())
+	}
+}
+
+func TestRedisRateLimiterFallback(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	core, logs := observer.New(zapcore.InfoLevel)
+	fallback := &countingLimiter{}
+	rl := NewRedisRateLimiter(rdb, "auth", 2, 10*time.Second, fallback, time.Hour, zap.New(core).Sugar())
+
+	mr.SetError("LOADING redis is loading the dataset in memory")
+	if got := rl.Allow("ip:10.0.0.1"); !got.Allowed || fallback.calls != 1 {
+		t.Fatalf("redis error: got %+v with %d fallback calls", got, fallback.calls)
+	}
+	// during the cooldown redis is not even tried
+	mr.SetError("")
+	rl.Allow("ip:10.0.0.1")
+	if fallback.calls != 2 || rl.Failures() != 1 {
+		t.Fatalf("cooldown: %d fallback calls and %d failures, want 2 and 1", fallback.calls, rl.Failures())
+	}
+	if mr.Exists("ratelimit:auth:ip:10.0.0.1") {
+		t.Fatal("redis was used during the cooldown")
+	}
+
+	// end the cooldown
+	rl.degradedUntil.Store(0)
+	if got := rl.Allow("ip:10.0.0.1"); !got.Allowed || got.Remaining != 1 || fallback.calls != 2 {
+		t.Fatalf("after the cooldown: got %+v with %d fallback calls", got, fallback.calls)
+	}
+	rl.Allow("ip:10.0.0.1")
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("logged %d messages, want one when degrading and one when recovering", len(entries))
+	}
+	if entries[0].Level != zapcore.WarnLevel || entries[1].Level != zapcore.InfoLevel {
+		t.Fatalf("logged %s then %s, want warn then info", entries[0].Level, entries[1].Level)
+	}
+}
@@ -0,0 +1,115 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+type slidingWindow struct {
+	start    time.Time
+	current  int
+	previous int
+}
+
+// SlidingWindowRateLimiter approximates a sliding log with two fixed window
+// counters: the previous window's count is weighted by how much of it still
+// overlaps the sliding window. This smooths out the boundary bursts of the
+// fixed window at the cost of one extra int per client.
+type SlidingWindowRateLimiter struct {
+	*janitor
+	sync.Mutex
+	clients map[string]*slidingWindow
+	limit   int
+	window  time.Duration
+	// now is time.Now, tests swap in their own clock
+	now func() time.Time
+}
+
+func NewSlidingWindowRateLimiter(limit int, window, janitorInterval time.Duration) *SlidingWindowRateLimiter {
+	rl := &SlidingWindowRateLimiter{
+		clients: make(map[string]*slidingWindow),
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+	}
+	rl.janitor = startJanitor(janitorInterval, rl.evict)
+	return rl
+}
+
+func (rl *SlidingWindowRateLimiter) Allow(key string) Result {
+	now := rl.now()
+
+	rl.Lock()
+	defer rl.Unlock()
+
+	client, exists := rl.clients[key]
+	if !exists {
+		client = &slidingWindow{start: now.Truncate(rl.window)}
+		rl.clients[key] = client
+	}
+	rl.advance(client, now)
+
+	elapsed := now.Sub(client.start)
+	weight := 1 - float64(elapsed)/float64(rl.window)
+	estimate := float64(client.previous)*weight + float64(client.current)
+	if estimate >= float64(rl.limit) {
+		retryAfter := rl.retryAfter(client, elapsed)
+		return Result{Limit: rl.limit, Reset: max(retryAfter, rl.reset(client, elapsed)), RetryAfter: retryAfter}
+	}
+
+	client.current++
+	return Result{
+		Allowed:   true,
+		Limit:     rl.limit,
+		Remaining: max(rl.limit-int(estimate)-1, 0),
+		Reset:     rl.reset(client, elapsed),
+	}
+}
+
+// reset is how long until nothing counted so far weighs anymore: the end of
+// the next window if the current one has requests, else the end of this one.
+func (rl *SlidingWindowRateLimiter) reset(client *slidingWindow, elapsed time.Duration) time.Duration {
+	if client.current > 0 {
+		return 2*rl.window - elapsed
+	}
+	return rl.window - elapsed
+}
+
+// advance rolls the client's counters forward to the window containing now.
+func (rl *SlidingWindowRateLimiter) advance(client *slidingWindow, now time.Time) {
+	start := now.Truncate(rl.window)
+	switch {
+	case start.Equal(client.start):
+	case start.Sub(client.start) == rl.window:
+		client.previous, client.current = client.current, 0
+		client.start = start
+	default:
+		client.previous, client.current = 0, 0
+		client.start = start
+	}
+}
+
+// retryAfter estimates when the weighted count drops below the limit.
+func (rl *SlidingWindowRateLimiter) retryAfter(client *slidingWindow, elapsed time.Duration) time.Duration {
+	limit := float64(rl.limit)
+	if client.current < rl.limit && client.previous > 0 {
+		// previous * (1 - t/window) + current < limit
+		t := float64(rl.window) * (1 - (limit-float64(client.current))/float64(client.previous))
+		return max(time.Duration(t)-elapsed, 0) + time.Millisecond
+	}
+	// the current window is full on its own: wait for it to become the
+	// previous one and decay far enough
+	t := float64(rl.window) * (1 - limit/float64(client.current))
+	return rl.window - elapsed + time.Duration(t) + time.Millisecond
+}
+
+func (rl *SlidingWindowRateLimiter) evict(now time.Time) {
+	rl.Lock()
+	defer rl.Unlock()
+	for key, client := range rl.clients {
+		// nothing counted in the current or previous window weighs anymore
+		if now.Sub(client.start) >= 2*rl.window {
+			delete(rl.clients, key)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucketRateLimiter gives every client a bucket of limit tokens that
+// refills continuously at limit per window. Clients may burst up to the
+// bucket size and are then held to the steady refill rate.
+type TokenBucketRateLimiter struct {
+	*janitor
+	sync.Mutex
+	clients map[string]*tokenBucket
+	limit   int
+	window  time.Duration
+	// now is time.Now, tests swap in their own clock
+	now func() time.Time
+	// tokens added per nanosecond
+	rate float64
+}
+
+func NewTokenBucketRateLimiter(limit int, window, janitorInterval time.Duration) *TokenBucketRateLimiter {
+	rl := &TokenBucketRateLimiter{
+		clients: make(map[string]*tokenBucket),
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		rate:    float64(limit) / float64(window),
+	}
+	rl.janitor = startJanitor(janitorInterval, rl.evict)
+	return rl
+}
+
+func (rl *TokenBucketRateLimiter) Allow(key string) Result {
+	now := rl.now()
+
+	rl.Lock()
+	defer rl.Unlock()
+
+	bucket, exists := rl.clients[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: float64(rl.limit), last: now}
+		rl.clients[key] = bucket
+	}
+
+	bucket.tokens = min(float64(rl.limit), bucket.tokens+float64(now.Sub(bucket.last))*rl.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return Result{
+			Limit:      rl.limit,
+			Reset:      rl.refill(bucket),
+			RetryAfter: rl.until(1 - bucket.tokens),
+		}
+	}
+
+	bucket.tokens--
+	return Result{Allowed: true, Limit: rl.limit, Remaining: int(bucket.tokens), Reset: rl.refill(bucket)}
+}
+
+// refill is how long until the bucket is full again.
+func (rl *TokenBucketRateLimiter) refill(bucket *tokenBucket) time.Duration {
+	return rl.until(float64(rl.limit) - bucket.tokens)
+}
+
+// until is how long refilling the given number of tokens takes, rounded up
+// so a client waiting exactly that long finds them there.
+func (rl *TokenBucketRateLimiter) until(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / rl.rate))
+}
+
+func (rl *TokenBucketRateLimiter) evict(now time.Time) {
+	rl.Lock()
+	defer rl.Unlock()
+	for key, bucket := range rl.clients {
+		// a bucket that has refilled completely is the same as a new one
+		if now.Sub(bucket.last) >= rl.window {
+			delete(rl.clients, key)
+		}
+	}
+}
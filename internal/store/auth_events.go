@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Authentication events kept for moderators reviewing attacks on accounts.
+const (
+	AuthEventLoginFailed     = "login_failed"
+	AuthEventAccountLocked   = "account_locked"
+	AuthEventAccountUnlocked = "account_unlocked"
+	AuthEventIPLocked        = "ip_locked"
+)
+
+type AuthEvent struct {
+	ID        int64     `json:"id"`
+	UserID    *int64    `json:"user_id"`
+	Event     string    `json:"event"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AuthEventStore struct {
+	db *sql.DB
+}
+
+func (s *AuthEventStore) Create(ctx context.Context, event *AuthEvent) error {
+	query := `INSERT INTO auth_events (user_id, event, ip, user_agent) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, event.UserID, event.Event, event.IP, event.UserAgent).Scan(&event.ID, &event.CreatedAt)
+}
+
+// ListByUserID returns the events recorded against userID, most recent first.
+func (s *AuthEventStore) ListByUserID(ctx context.Context, userID int64, page *PaginationQuery) ([]*AuthEvent, error) {
+	query := `
+		SELECT id, user_id, event, ip, user_agent, created_at
+		FROM auth_events
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, page.Limit, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*AuthEvent{}
+	for rows.Next() {
+		var event AuthEvent
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Event, &event.IP, &event.UserAgent, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
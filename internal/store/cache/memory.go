@@ -0,0 +1,208 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SAURABH200301/Social/internal/store"
+)
+
+// NewMemoryStorage keeps the cache in process, for deployments running
+// without Redis. Users and posts share one LRU of at most maxEntries and
+// expire after the same TTLs as in Redis.
+func NewMemoryStorage(maxEntries int) Storage {
+	lru := newLRU(maxEntries)
+	return Storage{
+		Users: &MemoryUserStore{lru: lru, generations: make(map[int64]int64)},
+		Posts: &MemoryPostStore{lru: lru},
+	}
+}
+
+type MemoryUserStore struct {
+	lru *lru
+
+	mu sync.Mutex
+	// generations counts the deletes of each user that a fill may still be
+	// racing, see UserStore.Generation
+	generations map[int64]int64
+}
+
+func (s *MemoryUserStore) Get(ctx context.Context, userID int64) (*store.Users, error) {
+	data, ok := s.lru.Get(fmt.Sprintf("user-%v", userID))
+	if !ok {
+		return nil, nil
+	}
+	if len(data) == 0 {
+		return nil, store.ErrNotFound
+	}
+	var user store.Users
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *MemoryUserStore) Generation(ctx context.Context, userID int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generations[userID], nil
+}
+
+// Set caches the user unless it was deleted since generation was read, like
+// UserStore.Set.
+func (s *MemoryUserStore) Set(ctx context.Context, user *store.Users, generation int64) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generations[user.ID] != generation {
+		return nil
+	}
+	s.lru.Set(fmt.Sprintf("user-%v", user.ID), data, jitter(UserExpTime))
+	return nil
+}
+
+func (s *MemoryUserStore) SetNotFound(ctx context.Context, userID int64) error {
+	s.lru.Set(fmt.Sprintf("user-%v", userID), nil, jitter(NotFoundExpTime))
+	return nil
+}
+
+func (s *MemoryUserStore) Delete(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generations[userID]++
+	s.lru.Delete(fmt.Sprintf("user-%v", userID))
+	return nil
+}
+
+type MemoryPostStore struct {
+	lru *lru
+}
+
+func (s *MemoryPostStore) Get(ctx context.Context, postID int32) (*store.Post, error) {
+	data, ok := s.lru.Get(fmt.Sprintf("post-%v", postID))
+	if !ok {
+		return nil, nil
+	}
+	var post store.Post
+	if err := json.Unmarshal(data, &post); err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// Set caches the post without its reactions and never replaces a newer
+// version of it, like PostStore.Set.
+func (s *MemoryPostStore) Set(ctx context.Context, post *store.Post) error {
+	cached := *post
+	cached.Reactions = nil
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	s.lru.SetUnless(fmt.Sprintf("post-%v", post.ID), data, jitter(PostExpTime), func(current []byte) bool {
+		var newer struct {
+			Version int32 `json:"version"`
+		}
+		return json.Unmarshal(current, &newer) == nil && newer.Version > post.Version
+	})
+	return nil
+}
+
+func (s *MemoryPostStore) Delete(ctx context.Context, postID int32) error {
+	s.lru.Delete(fmt.Sprintf("post-%v", postID))
+	return nil
+}
+
+// lru is a map bounded to maxEntries that evicts the least recently used
+// entry first. Entries past their TTL count as missing and are dropped when
+// they are next looked up. Values are stored encoded, so callers never share
+// or mutate a cached value.
+type lru struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+func newLRU(maxEntries int) *lru {
+	return &lru{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (c *lru) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.remove(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.value, true
+}
+
+func (c *lru) Set(key string, value []byte, ttl time.Duration) {
+	c.SetUnless(key, value, ttl, nil)
+}
+
+// SetUnless is Set, except that it keeps the current value of key when skip
+// returns true for it. skip runs under the lock, so nothing can change the
+// value between the check and the write.
+func (c *lru) SetUnless(key string, value []byte, ttl time.Duration, skip func(current []byte) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok && skip != nil {
+		entry := el.Value.(*lruEntry)
+		if time.Now().Before(entry.expiresAt) && skip(entry.value) {
+			return
+		}
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value, entry.expiresAt = value, expiresAt
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *lru) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *lru) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*lruEntry).key)
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SAURABH200301/Social/internal/store"
+	"github.com/redis/go-redis/v9"
+)
+
+type PostStore struct {
+	rdb *redis.Client
+}
+
+// PostExpTime is the base TTL of a cached post, jittered on every Set.
+const PostExpTime = time.Minute
+
+// Get returns the cached post, or nil when it is not cached.
+func (s *PostStore) Get(ctx context.Context, postID int32) (*store.Post, error) {
+	cacheKey := fmt.Sprintf("post-%v", postID)
+	data, err := s.rdb.Get(ctx, cacheKey).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var post store.Post
+	if err := json.Unmarshal([]byte(data), &post); err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// setPostScript caches the post ARGV[1] of version ARGV[2] under KEYS[1] for
+// ARGV[3] milliseconds, unless a newer version of it is cached already.
+var setPostScript = redis.NewScript(`
+local cached = redis.call('GET', KEYS[1])
+if cached then
+	local ok, post = pcall(cjson.decode, cached)
+	if ok and tonumber(post.version) and tonumber(post.version) > tonumber(ARGV[2]) then
+		return 0
+	end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+return 1
+`)
+
+// Set caches the post itself. Reactions are left out, they change
+// independently of the post and differ per viewer. A post older than the
+// cached version is not stored, so a slow fill cannot put back a version an
+// update has already replaced.
+func (s *PostStore) Set(ctx context.Context, post *store.Post) error {
+	cacheKey := fmt.Sprintf("post-%v", post.ID)
+	cached := *post
+	cached.Reactions = nil
+	json, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	ttl := jitter(PostExpTime).Milliseconds()
+	return setPostScript.Run(ctx, s.rdb, []string{cacheKey}, json, post.Version, ttl).Err()
+}
+
+func (s *PostStore) Delete(ctx context.Context, postID int32) error {
+	cacheKey := fmt.Sprintf("post-%v", postID)
+	return s.rdb.Del(ctx, cacheKey).Err()
+}
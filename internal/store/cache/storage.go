@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"math/rand/v2"
+	"time"
 
 	"github.com/SAURABH200301/Social/internal/store"
 	"github.com/redis/go-redis/v9"
@@ -9,8 +11,24 @@ import (
 
 type Storage struct {
 	Users interface {
+		// Get returns nil, nil on a miss and store.ErrNotFound when the user
+		// is cached as missing.
 		Get(context.Context, int64) (*store.Users, error)
-		Set(context.Context, *store.Users) error
+		// Generation returns a number that every Delete of the user
+		// changes. Fills read it before loading the user from the database.
+		Generation(context.Context, int64) (int64, error)
+		// Set caches the user, unless it was deleted since the fill read
+		// generation, in which case the loaded copy may be stale.
+		Set(ctx context.Context, user *store.Users, generation int64) error
+		// SetNotFound remembers for NotFoundExpTime that the user does not
+		// exist.
+		SetNotFound(context.Context, int64) error
+		Delete(context.Context, int64) error
+	}
+	Posts interface {
+		Get(context.Context, int32) (*store.Post, error)
+		Set(context.Context, *store.Post) error
+		Delete(context.Context, int32) error
 	}
 }
 
@@ -19,5 +37,21 @@ func NewRedisStorage(rdb *redis.Client) Storage {
 		Users: &UserStore{
 			rdb: rdb,
 		},
+		Posts: &PostStore{
+			rdb: rdb,
+		},
+	}
+}
+
+// NotFoundExpTime is how long a lookup that found nothing is remembered.
+const NotFoundExpTime = 10 * time.Second
+
+// jitter spreads ttl by up to 10% either way, so entries filled together do
+// not all expire, and get refilled, at the same moment.
+func jitter(ttl time.Duration) time.Duration {
+	spread := int64(ttl) / 5
+	if spread <= 0 {
+		return ttl
 	}
+	return ttl - time.Duration(spread/2) + time.Duration(rand.Int64N(spread))
 }
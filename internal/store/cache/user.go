@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -14,29 +15,78 @@ type UserStore struct {
 	rdb *redis.Client
 }
 
+// UserExpTime is the base TTL of a cached user, jittered on every Set.
 const UserExpTime = time.Minute
 
 func (s *UserStore) Get(ctx context.Context, userID int64) (*store.Users, error) {
 	cacheKey := fmt.Sprintf("user-%v", userID)
 	data, err := s.rdb.Get(ctx, cacheKey).Result()
 	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
 		return nil, err
 	}
+	// an empty value marks a user known not to exist
+	if data == "" {
+		return nil, store.ErrNotFound
+	}
 	var user store.Users
-	if data != "" {
-		err := json.Unmarshal([]byte(data), &user)
-		if err != nil {
-			return nil, err
-		}
+	if err := json.Unmarshal([]byte(data), &user); err != nil {
+		return nil, err
 	}
 	return &user, nil
 }
 
-func (s *UserStore) Set(ctx context.Context, user *store.Users) error {
+// setUserScript caches the user ARGV[1] under KEYS[1] for ARGV[3]
+// milliseconds, unless the generation in KEYS[2] is no longer ARGV[2].
+var setUserScript = redis.NewScript(`
+local generation = tonumber(redis.call('GET', KEYS[2])) or 0
+if generation ~= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+return 1
+`)
+
+// generationKey counts the deletes of a cached user. It outlives any fill,
+// and once it expires a fill still holding the old generation is refused.
+func generationKey(userID int64) string {
+	return fmt.Sprintf("user-%v-generation", userID)
+}
+
+func (s *UserStore) Generation(ctx context.Context, userID int64) (int64, error) {
+	generation, err := s.rdb.Get(ctx, generationKey(userID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return generation, err
+}
+
+func (s *UserStore) Set(ctx context.Context, user *store.Users, generation int64) error {
 	cacheKey := fmt.Sprintf("user-%v", user.ID)
 	json, err := json.Marshal(user)
 	if err != nil {
 		return err
 	}
-	return s.rdb.SetEx(ctx, cacheKey, json, UserExpTime).Err()
+	ttl := jitter(UserExpTime).Milliseconds()
+	return setUserScript.Run(ctx, s.rdb, []string{cacheKey, generationKey(user.ID)}, json, generation, ttl).Err()
+}
+
+func (s *UserStore) SetNotFound(ctx context.Context, userID int64) error {
+	cacheKey := fmt.Sprintf("user-%v", userID)
+	return s.rdb.SetEx(ctx, cacheKey, "", jitter(NotFoundExpTime)).Err()
+}
+
+// Delete drops the cached user and bumps its generation, so a fill that
+// loaded the user before the change cannot cache it again.
+func (s *UserStore) Delete(ctx context.Context, userID int64) error {
+	cacheKey := fmt.Sprintf("user-%v", userID)
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, cacheKey)
+		pipe.Incr(ctx, generationKey(userID))
+		pipe.Expire(ctx, generationKey(userID), UserExpTime)
+		return nil
+	})
+	return err
 }
@@ -3,44 +3,166 @@ package store
 import (
 	"context"
 	"database/sql"
-	"fmt"
+	"errors"
 )
 
 type Comments struct {
-	ID        int32  `json:"id"`
-	PostID    int32  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	User      Users  `json:"user"`
+	ID           int32       `json:"id"`
+	PostID       int32       `json:"post_id"`
+	ParentID     *int32      `json:"parent_id"`
+	UserID       int64       `json:"user_id"`
+	Content      string      `json:"content"`
+	CreatedAt    string      `json:"created_at"`
+	User         Users       `json:"user"`
+	RepliesCount int         `json:"replies_count"`
+	Replies      []*Comments `json:"replies,omitempty"`
 }
 type CommentsStore struct {
 	db *sql.DB
 }
 
-func (s *CommentsStore) GetCommentsByPostID(ctx context.Context, postID int32) ([]*Comments, error) {
-	query := `SELECT comments.id, comments.content, comments.post_id, comments.user_id, comments.created_at, users.username FROM comments JOIN users ON users.id = comments.user_id WHERE post_id = $1 ORDER BY comments.created_at DESC`
+// CountByPostID counts every comment of a post, replies included.
+func (s *CommentsStore) CountByPostID(ctx context.Context, postID int32) (int, error) {
+	query := `SELECT COUNT(*) FROM comments WHERE post_id = $1`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	var count int
+	err := s.db.QueryRowContext(ctx, query, postID).Scan(&count)
+	return count, err
+}
+
+func (s *CommentsStore) Create(ctx context.Context, comment *Comments) error {
+	query := `INSERT INTO comments (post_id, parent_id, user_id, content) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, comment.PostID, comment.ParentID, comment.UserID, comment.Content).Scan(&comment.ID, &comment.CreatedAt)
+}
+
+func (s *CommentsStore) GetByID(ctx context.Context, id int32) (*Comments, error) {
+	query := `
+		SELECT comments.id, comments.content, comments.post_id, comments.parent_id, comments.user_id, comments.created_at, users.username,
+		(SELECT COUNT(*) FROM comments replies WHERE replies.parent_id = comments.id) AS replies_count
+		FROM comments JOIN users ON users.id = comments.user_id WHERE comments.id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var comment Comments
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&comment.ID, &comment.Content, &comment.PostID, &comment.ParentID, &comment.UserID, &comment.CreatedAt, &comment.User.Username, &comment.RepliesCount)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("record not found")
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
 		}
 		return nil, err
 	}
+	comment.User.ID = comment.UserID
+	return &comment, nil
+}
+
+// GetThread returns the comments of a post as a tree. Roots are the direct
+// replies to parentID, or the top-level comments when parentID is nil.
+// Every level is paginated separately: roots honour both Limit and Offset,
+// deeper levels return at most Limit replies per comment, and nothing below
+// Depth levels is loaded. RepliesCount tells the client whether there are
+// more replies to fetch.
+func (s *CommentsStore) GetThread(ctx context.Context, postID int32, parentID *int32, tq *CommentThreadQuery) ([]*Comments, error) {
+	query := `
+		WITH RECURSIVE ranked AS (
+			SELECT c.id, c.content, c.post_id, c.parent_id, c.user_id, c.created_at,
+			ROW_NUMBER() OVER (
+				PARTITION BY c.parent_id
+				ORDER BY CASE WHEN c.parent_id IS NULL THEN c.created_at END DESC, c.created_at, c.id
+			) AS rn
+			FROM comments c
+			WHERE c.post_id = $1
+		), thread AS (
+			SELECT r.*, 1 AS depth
+			FROM ranked r
+			WHERE r.parent_id IS NOT DISTINCT FROM $2::int AND r.rn > $4 AND r.rn <= $4 + $3
+			UNION ALL
+			SELECT r.*, t.depth + 1
+			FROM ranked r
+			JOIN thread t ON r.parent_id = t.id
+			WHERE t.depth < $5 AND r.rn <= $3
+		)
+		SELECT t.id, t.content, t.post_id, t.parent_id, t.user_id, t.created_at, u.username, t.depth,
+		(SELECT COUNT(*) FROM comments replies WHERE replies.parent_id = t.id) AS replies_count
+		FROM thread t
+		JOIN users u ON u.id = t.user_id
+		ORDER BY t.depth, t.rn`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID, parentID, tq.Limit, tq.Offset, tq.Depth)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	var comments []*Comments
+	roots := []*Comments{}
+	byID := make(map[int32]*Comments)
 	for rows.Next() {
 		var comment Comments
-		if err := rows.Scan(&comment.ID, &comment.Content, &comment.PostID, &comment.UserID, &comment.CreatedAt, &comment.User.Username); err != nil {
+		var depth int
+		if err := rows.Scan(&comment.ID, &comment.Content, &comment.PostID, &comment.ParentID, &comment.UserID, &comment.CreatedAt, &comment.User.Username, &depth, &comment.RepliesCount); err != nil {
 			return nil, err
 		}
 		comment.User.ID = comment.UserID
-		comments = append(comments, &comment)
+		byID[comment.ID] = &comment
+
+		// rows arrive ordered by depth, so a reply's parent is always seen first
+		if depth == 1 {
+			roots = append(roots, &comment)
+			continue
+		}
+		if parent, ok := byID[*comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, &comment)
+		}
+	}
+	return roots, rows.Err()
+}
+
+func (s *CommentsStore) Update(ctx context.Context, comment *Comments) error {
+	query := `UPDATE comments SET content = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, comment.Content, comment.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *CommentsStore) Delete(ctx context.Context, id int32) error {
+	query := `DELETE FROM comments WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
 	}
-	return comments, nil
+	return nil
 }
@@ -0,0 +1,251 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// States of a queued email. A pending email waits for its next attempt, a
+// sending one is leased by a worker, and a dead one ran out of attempts and
+// waits for an admin to retry it, unless it carried a one-time link. A suppressed email was dropped because the
+// user opted out of its kind.
+const (
+	EmailStatusPending    = "pending"
+	EmailStatusSending    = "sending"
+	EmailStatusSent       = "sent"
+	EmailStatusDead       = "dead"
+	EmailStatusSuppressed = "suppressed"
+)
+
+type OutboxEmail struct {
+	ID       int64  `json:"id"`
+	UserID   int64  `json:"user_id"`
+	Template string `json:"template"`
+	Locale   string `json:"locale"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	// Data holds the template variables. It can contain one-time links, so
+	// it is never serialized, never read for listings and is cleared once
+	// the email was sent, or dead-lettered when OneTime is set.
+	Data json.RawMessage `json:"-"`
+	// OneTime marks an email carrying a link that can only be used once.
+	OneTime       bool       `json:"one_time"`
+	Sandbox       bool       `json:"sandbox"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+const outboxEmailColumns = `id, user_id, template, locale, username, email, data, one_time, sandbox, status, attempts, last_error, next_attempt_at, sent_at, created_at`
+
+// outboxEmailListColumns reads emails for inspection. Only the workers need
+// the template variables, so an empty object stands in for them.
+const outboxEmailListColumns = `id, user_id, template, locale, username, email, '{}'::jsonb, one_time, sandbox, status, attempts, last_error, next_attempt_at, sent_at, created_at`
+
+type EmailOutboxStore struct {
+	db *sql.DB
+}
+
+// Enqueue queues an email for the delivery workers.
+func (s *EmailOutboxStore) Enqueue(ctx context.Context, email *OutboxEmail) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return enqueueEmail(ctx, tx, email)
+	})
+}
+
+// enqueueEmail queues an email as part of tx, so it is only ever sent if
+// whatever it announces was committed.
+func enqueueEmail(ctx context.Context, tx *sql.Tx, email *OutboxEmail) error {
+	query := `
+		INSERT INTO email_outbox (user_id, template, locale, username, email, data, one_time, sandbox)
+		VALUES ($1, $2, COALESCE(NULLIF($3, ''), 'en'), $4, $5, $6, $7, $8)
+		RETURNING id, status, next_attempt_at, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	return tx.QueryRowContext(ctx, query, email.UserID, email.Template, email.Locale, email.Username, email.Email, []byte(email.Data), email.OneTime, email.Sandbox).Scan(
+		&email.ID,
+		&email.Status,
+		&email.NextAttemptAt,
+		&email.CreatedAt,
+	)
+}
+
+// Claim leases up to limit due emails to the caller for lease and counts the
+// attempt. Emails whose lease ran out, because the worker holding them died,
+// are due again. Concurrent callers never claim the same email.
+func (s *EmailOutboxStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]*OutboxEmail, error) {
+	query := `
+		UPDATE email_outbox SET status = 'sending', attempts = attempts + 1, locked_until = NOW() + $2 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE (status = 'pending' AND next_attempt_at <= NOW())
+			   OR (status = 'sending' AND locked_until <= NOW())
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + outboxEmailColumns
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanOutboxEmails(rows)
+}
+
+// leaseHeld limits an update to the claim email came from: the email is still
+// leased, and not yet reclaimed by another worker after the lease ran out,
+// which would have counted another attempt.
+const leaseHeld = `status = 'sending' AND locked_until > NOW() AND attempts = $2`
+
+// MarkSent records a delivery and drops the template variables. It returns
+// ErrNotFound when the lease on email was lost.
+func (s *EmailOutboxStore) MarkSent(ctx context.Context, email *OutboxEmail) error {
+	query := `
+		UPDATE email_outbox SET status = 'sent', sent_at = NOW(), locked_until = NULL, last_error = '', data = '{}'
+		WHERE id = $1 AND ` + leaseHeld
+	return s.exec(ctx, query, email.ID, email.Attempts)
+}
+
+// Reschedule releases an email after a failed attempt, to be tried again at
+// the given time.
+func (s *EmailOutboxStore) Reschedule(ctx context.Context, email *OutboxEmail, lastError string, at time.Time) error {
+	query := `
+		UPDATE email_outbox SET status = 'pending', locked_until = NULL, last_error = $3, next_attempt_at = $4
+		WHERE id = $1 AND ` + leaseHeld
+	return s.exec(ctx, query, email.ID, email.Attempts, lastError, at)
+}
+
+// DeadLetter gives up on an email until an admin retries it. The template
+// variables of a one-time email are cleared, it can no longer be retried.
+func (s *EmailOutboxStore) DeadLetter(ctx context.Context, email *OutboxEmail, lastError string) error {
+	query := `
+		UPDATE email_outbox SET status = 'dead', locked_until = NULL, last_error = $3,
+			data = CASE WHEN one_time THEN '{}' ELSE data END
+		WHERE id = $1 AND ` + leaseHeld
+	return s.exec(ctx, query, email.ID, email.Attempts, lastError)
+}
+
+// Suppress drops an email without sending it, like MarkSent it clears the
+// template variables.
+func (s *EmailOutboxStore) Suppress(ctx context.Context, email *OutboxEmail, reason string) error {
+	query := `
+		UPDATE email_outbox SET status = 'suppressed', locked_until = NULL, last_error = $3, data = '{}'
+		WHERE id = $1 AND ` + leaseHeld
+	return s.exec(ctx, query, email.ID, email.Attempts, reason)
+}
+
+// Retry makes a pending or dead email due right away. A dead email gets a
+// fresh set of attempts, unless it was a one-time email whose variables are
+// gone.
+func (s *EmailOutboxStore) Retry(ctx context.Context, id int64) error {
+	query := `
+		UPDATE email_outbox SET
+			attempts = CASE WHEN status = 'dead' THEN 0 ELSE attempts END,
+			status = 'pending',
+			next_attempt_at = NOW()
+		WHERE id = $1 AND (status = 'pending' OR (status = 'dead' AND NOT one_time))`
+	return s.exec(ctx, query, id)
+}
+
+func (s *EmailOutboxStore) GetByID(ctx context.Context, id int64) (*OutboxEmail, error) {
+	query := `SELECT ` + outboxEmailListColumns + ` FROM email_outbox WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails, err := scanOutboxEmails(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(emails) == 0 {
+		return nil, ErrNotFound
+	}
+	return emails[0], nil
+}
+
+// List returns queued emails, newest first, optionally only those in one
+// status.
+func (s *EmailOutboxStore) List(ctx context.Context, query *EmailOutboxQuery) ([]*OutboxEmail, error) {
+	sqlQuery := `
+		SELECT ` + outboxEmailListColumns + ` FROM email_outbox
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, query.Status, query.Limit, query.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanOutboxEmails(rows)
+}
+
+func (s *EmailOutboxStore) exec(ctx context.Context, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanOutboxEmails(rows *sql.Rows) ([]*OutboxEmail, error) {
+	emails := []*OutboxEmail{}
+	for rows.Next() {
+		var email OutboxEmail
+		var data []byte
+		err := rows.Scan(
+			&email.ID,
+			&email.UserID,
+			&email.Template,
+			&email.Locale,
+			&email.Username,
+			&email.Email,
+			&data,
+			&email.OneTime,
+			&email.Sandbox,
+			&email.Status,
+			&email.Attempts,
+			&email.LastError,
+			&email.NextAttemptAt,
+			&email.SentAt,
+			&email.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		email.Data = data
+		emails = append(emails, &email)
+	}
+	return emails, rows.Err()
+}
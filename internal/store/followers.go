@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type FollowCounts struct {
+	Followers int `json:"followers_count"`
+	Following int `json:"following_count"`
+}
+
+// PublicUser is what anyone signed in may see of another user in lists of
+// followers and followees.
+type PublicUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	CreatedAt string `json:"created_at"`
+}
+
+type FollowerStore struct {
+	db *sql.DB
+}
+
+// Follow makes followerID follow userID.
+func (s *FollowerStore) Follow(ctx context.Context, followerID, userID int64) error {
+	query := `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, followerID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code {
+			case "23505":
+				return ErrConflict
+			case "23503":
+				return ErrNotFound
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// ClaimNotification reports whether userID should hear about followerID
+// following them, which is only the first time ever. Unfollowing and
+// following again does not notify again.
+func (s *FollowerStore) ClaimNotification(ctx context.Context, followerID, userID int64) (bool, error) {
+	query := `
+		INSERT INTO follow_notifications (user_id, follower_id) VALUES ($1, $2)
+		ON CONFLICT (user_id, follower_id) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID, followerID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+func (s *FollowerStore) Unfollow(ctx context.Context, followerID, userID int64) error {
+	query := `DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID, followerID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetFollowers returns the users following userID, most recent first.
+func (s *FollowerStore) GetFollowers(ctx context.Context, userID int64, page *PaginationQuery) ([]*PublicUser, error) {
+	query := `
+		SELECT u.id, u.username, u.created_at
+		FROM followers f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.user_id = $1
+		ORDER BY f.created_at DESC
+		LIMIT $2 OFFSET $3`
+	return s.listUsers(ctx, query, userID, page)
+}
+
+// GetFollowing returns the users followed by userID, most recent first.
+func (s *FollowerStore) GetFollowing(ctx context.Context, userID int64, page *PaginationQuery) ([]*PublicUser, error) {
+	query := `
+		SELECT u.id, u.username, u.created_at
+		FROM followers f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.follower_id = $1
+		ORDER BY f.created_at DESC
+		LIMIT $2 OFFSET $3`
+	return s.listUsers(ctx, query, userID, page)
+}
+
+func (s *FollowerStore) GetCounts(ctx context.Context, userID int64) (*FollowCounts, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM followers WHERE user_id = $1),
+			(SELECT COUNT(*) FROM followers WHERE follower_id = $1)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var counts FollowCounts
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&counts.Followers, &counts.Following)
+	if err != nil {
+		return nil, err
+	}
+	return &counts, nil
+}
+
+func (s *FollowerStore) listUsers(ctx context.Context, query string, userID int64, page *PaginationQuery) ([]*PublicUser, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, page.Limit, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*PublicUser{}
+	for rows.Next() {
+		var user PublicUser
+		if err := rows.Scan(&user.ID, &user.Username, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LoginThrottle counts consecutive failed logins against one key: an
+// account, an email address without an account, or a client IP.
+type LoginThrottle struct {
+	Key          string
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
+
+func (t *LoginThrottle) Locked(now time.Time) bool {
+	return t != nil && t.LockedUntil != nil && now.Before(*t.LockedUntil)
+}
+
+func AccountThrottleKey(userID int64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// EmailThrottleKey keys failed logins for an email address that has no
+// account, so unknown addresses are throttled like accounts. The address is
+// hashed to keep it out of the table.
+func EmailThrottleKey(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return "email:" + hex.EncodeToString(sum[:])
+}
+
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+type LoginThrottleStore struct {
+	db *sql.DB
+}
+
+// Get returns the throttle state of key, or ErrNotFound when it has no
+// recorded failures.
+func (s *LoginThrottleStore) Get(ctx context.Context, key string) (*LoginThrottle, error) {
+	query := `SELECT key, failures, last_failed_at, locked_until FROM login_throttles WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var throttle LoginThrottle
+	err := s.db.QueryRowContext(ctx, query, key).Scan(&throttle.Key, &throttle.Failures, &throttle.LastFailedAt, &throttle.LockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+// ThrottlePolicy decides when a key may try to log in again: FreeAttempts
+// failures are allowed back to back, after that every attempt waits
+// BaseDelay, doubling with every failure up to MaxDelay. Failures older than
+// Window are forgotten, so the count restarts after a quiet period.
+type ThrottlePolicy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Window       time.Duration
+}
+
+// Reserve counts a login attempt against key before the credentials are
+// checked, unless key is locked out or still backing off. Checking and
+// counting in one statement keeps parallel attempts from all passing the
+// check before any of them failed. It reports whether the attempt was
+// counted and returns the throttle state either way, nil when key has none.
+// An attempt that turns out to succeed is given back with Release.
+func (s *LoginThrottleStore) Reserve(ctx context.Context, key string, policy ThrottlePolicy) (*LoginThrottle, bool, error) {
+	query := `
+		INSERT INTO login_throttles (key, failures, last_failed_at) VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttles.last_failed_at < NOW() - make_interval(secs => $2) THEN 1
+				ELSE login_throttles.failures + 1
+			END,
+			last_failed_at = NOW()
+		WHERE (login_throttles.locked_until IS NULL OR login_throttles.locked_until <= NOW())
+		  AND (login_throttles.failures <= $3::int
+			OR login_throttles.last_failed_at < NOW() - make_interval(secs => $2)
+			OR login_throttles.last_failed_at + make_interval(secs => LEAST($5::float8,
+				$4::float8 * power(2, LEAST(login_throttles.failures - $3::int - 1, 30)))) <= NOW())
+		RETURNING key, failures, last_failed_at, locked_until`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var throttle LoginThrottle
+	err := s.db.QueryRowContext(ctx, query, key, policy.Window.Seconds(), policy.FreeAttempts, policy.BaseDelay.Seconds(), policy.MaxDelay.Seconds()).Scan(
+		&throttle.Key,
+		&throttle.Failures,
+		&throttle.LastFailedAt,
+		&throttle.LockedUntil,
+	)
+	if err == nil {
+		return &throttle, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	// the row exists but refused the attempt
+	current, err := s.Get(ctx, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, false, err
+	}
+	return current, false, nil
+}
+
+// Release gives back an attempt counted by Reserve that succeeded.
+func (s *LoginThrottleStore) Release(ctx context.Context, key string) error {
+	query := `UPDATE login_throttles SET failures = GREATEST(failures - 1, 0) WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, key)
+	return err
+}
+
+// Lock blocks key until the given time. The failure count starts over so the
+// backoff does not stack on top of the lockout once it ends.
+func (s *LoginThrottleStore) Lock(ctx context.Context, key string, until time.Time) error {
+	query := `UPDATE login_throttles SET locked_until = $2, failures = 0 WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, key, until)
+	return err
+}
+
+func (s *LoginThrottleStore) Reset(ctx context.Context, key string) error {
+	query := `DELETE FROM login_throttles WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, key)
+	return err
+}
+
+// CreateUnlock stores an unlock token for userID and queues the email that
+// carries it in the same transaction, so there is never a token without an
+// email or the other way round.
+func (s *LoginThrottleStore) CreateUnlock(ctx context.Context, userID int64, tokenHash string, exp time.Duration, email *OutboxEmail) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `INSERT INTO account_unlocks (user_id, token_hash, expiry) VALUES ($1, $2, $3)`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, query, userID, tokenHash, time.Now().Add(exp)); err != nil {
+			return err
+		}
+		return enqueueEmail(ctx, tx, email)
+	})
+}
+
+// Unlock consumes an unlock token and clears the lockout of its account. It
+// returns the ID of the unlocked user, or ErrNotFound for an unknown or
+// expired token.
+func (s *LoginThrottleStore) Unlock(ctx context.Context, tokenHash string) (int64, error) {
+	var userID int64
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		query := `DELETE FROM account_unlocks WHERE token_hash = $1 AND expiry > NOW() RETURNING user_id`
+		err := tx.QueryRowContext(ctx, query, tokenHash).Scan(&userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM account_unlocks WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM login_throttles WHERE key = $1`, AccountThrottleKey(userID))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
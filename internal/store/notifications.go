@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of optional email a user can opt out of. NotificationAll stands for
+// every one of them at once. Account emails, such as password resets, have
+// no kind and are always sent.
+const (
+	NotificationNewFollower  = "new_follower"
+	NotificationWeeklyDigest = "weekly_digest"
+	NotificationAll          = "all"
+)
+
+var ErrUnknownNotification = errors.New("unknown notification")
+
+// columns of notification_settings by notification kind
+var notificationColumns = map[string]string{
+	NotificationNewFollower:  "email_new_follower",
+	NotificationWeeklyDigest: "weekly_digest",
+}
+
+// NotificationSettings says which optional emails a user gets. Users who
+// never changed them have no row and get DefaultNotificationSettings.
+type NotificationSettings struct {
+	UserID       int64      `json:"-"`
+	NewFollower  bool       `json:"new_follower"`
+	WeeklyDigest bool       `json:"weekly_digest"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+}
+
+func DefaultNotificationSettings(userID int64) *NotificationSettings {
+	return &NotificationSettings{
+		UserID:      userID,
+		NewFollower: true,
+	}
+}
+
+// Allows reports whether the user gets emails of the given kind. An empty
+// kind is an account email, which is always allowed.
+func (n *NotificationSettings) Allows(kind string) bool {
+	switch kind {
+	case "":
+		return true
+	case NotificationNewFollower:
+		return n.NewFollower
+	case NotificationWeeklyDigest:
+		return n.WeeklyDigest
+	default:
+		return false
+	}
+}
+
+type NotificationSettingsStore struct {
+	db *sql.DB
+}
+
+func (s *NotificationSettingsStore) Get(ctx context.Context, userID int64) (*NotificationSettings, error) {
+	query := `
+		SELECT user_id, email_new_follower, weekly_digest, updated_at
+		FROM notification_settings WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var settings NotificationSettings
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&settings.UserID,
+		&settings.NewFollower,
+		&settings.WeeklyDigest,
+		&settings.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return DefaultNotificationSettings(userID), nil
+		}
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// Update stores every setting of a user. It returns ErrNotFound when the user
+// does not exist.
+func (s *NotificationSettingsStore) Update(ctx context.Context, settings *NotificationSettings) error {
+	query := `
+		INSERT INTO notification_settings (user_id, email_new_follower, weekly_digest)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET
+			email_new_follower = EXCLUDED.email_new_follower,
+			weekly_digest = EXCLUDED.weekly_digest,
+			updated_at = NOW()
+		RETURNING updated_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, settings.UserID, settings.NewFollower, settings.WeeklyDigest).Scan(&settings.UpdatedAt)
+	return notificationError(err)
+}
+
+// Unsubscribe turns off one kind of email, or all of them for
+// NotificationAll, leaving the other settings as they were.
+func (s *NotificationSettingsStore) Unsubscribe(ctx context.Context, userID int64, kind string) error {
+	var columns []string
+	if kind == NotificationAll {
+		for _, column := range notificationColumns {
+			columns = append(columns, column)
+		}
+	} else {
+		column, ok := notificationColumns[kind]
+		if !ok {
+			return fmt.Errorf("%w %q", ErrUnknownNotification, kind)
+		}
+		columns = []string{column}
+	}
+
+	values := make([]string, len(columns))
+	updates := make([]string, len(columns))
+	for i, column := range columns {
+		values[i] = "FALSE"
+		updates[i] = column + " = FALSE"
+	}
+	query := fmt.Sprintf(`
+		INSERT INTO notification_settings (user_id, %s) VALUES ($1, %s)
+		ON CONFLICT (user_id) DO UPDATE SET %s, updated_at = NOW()`,
+		strings.Join(columns, ", "), strings.Join(values, ", "), strings.Join(updates, ", "))
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return notificationError(err)
+}
+
+func notificationError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+		return ErrNotFound
+	}
+	return err
+}
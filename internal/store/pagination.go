@@ -1,6 +1,7 @@
 package store
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -15,8 +16,8 @@ type PaginationFeedQuery struct {
 	Sort   string   `json:"sort" validate:"oneof=ASC DESC"`
 	Tags   []string `json:"tags" validate:"max=5"`
 	Search string   `json:"search" validate:"max=100"`
-	Since  string   `json:"since" validate:"omitempty,datetime=2006-01-02"`
-	Until  string   `json:"until" validate:"omitempty,datetime=2006-01-02"`
+	Since  string   `json:"since" validate:"omitempty,datetime=2006-01-02 15:04:05"`
+	Until  string   `json:"until" validate:"omitempty,datetime=2006-01-02 15:04:05"`
 }
 
 func (fq *PaginationFeedQuery) Parse(r *http.Request) (*PaginationFeedQuery, error) {
@@ -25,8 +26,8 @@ func (fq *PaginationFeedQuery) Parse(r *http.Request) (*PaginationFeedQuery, err
 	limit := qs.Get("limit")
 	if limit != "" {
 		l, err := strconv.Atoi(limit)
-		if err == nil {
-			fq.Limit = l
+		if err != nil {
+			return nil, err
 		}
 		fq.Limit = l
 	}
@@ -34,8 +35,8 @@ func (fq *PaginationFeedQuery) Parse(r *http.Request) (*PaginationFeedQuery, err
 	offset := qs.Get("offset")
 	if offset != "" {
 		o, err := strconv.Atoi(offset)
-		if err == nil {
-			fq.Offset = o
+		if err != nil {
+			return nil, err
 		}
 		fq.Offset = o
 	}
@@ -44,6 +45,7 @@ func (fq *PaginationFeedQuery) Parse(r *http.Request) (*PaginationFeedQuery, err
 	if sort != "" {
 		fq.Sort = sort
 	}
+	fq.Sort = strings.ToUpper(fq.Sort)
 
 	tags := qs.Get("tags")
 	if tags != "" {
@@ -56,19 +58,136 @@ func (fq *PaginationFeedQuery) Parse(r *http.Request) (*PaginationFeedQuery, err
 	}
 	since := qs.Get("since")
 	if since != "" {
-		fq.Since = ParseTime(since)
+		t, err := ParseTime(since)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since: %w", err)
+		}
+		fq.Since = t
 	}
 	until := qs.Get("until")
 	if until != "" {
-		fq.Until = ParseTime(until)
+		t, err := ParseTime(until)
+		if err != nil {
+			return nil, fmt.Errorf("invalid until: %w", err)
+		}
+		fq.Until = t
 	}
 	return fq, nil
 }
 
-func ParseTime(timeStr string) string {
-	t, err := time.Parse(time.DateTime, timeStr)
-	if err != nil {
-		return ""
+type PaginationQuery struct {
+	Limit  int `json:"limit" validate:"gte=1,lte=100"`
+	Offset int `json:"offset" validate:"gte=0"`
+}
+
+func (pq *PaginationQuery) Parse(r *http.Request) (*PaginationQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return nil, err
+		}
+		pq.Limit = l
+	}
+
+	offset := qs.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return nil, err
+		}
+		pq.Offset = o
+	}
+	return pq, nil
+}
+
+// CommentThreadQuery paginates a comment tree level by level. Depth bounds
+// how many levels below the roots are loaded in one request.
+type CommentThreadQuery struct {
+	Limit  int `json:"limit" validate:"gte=1,lte=100"`
+	Offset int `json:"offset" validate:"gte=0"`
+	Depth  int `json:"depth" validate:"gte=1,lte=10"`
+}
+
+func (tq *CommentThreadQuery) Parse(r *http.Request) (*CommentThreadQuery, error) {
+	pq := PaginationQuery{Limit: tq.Limit, Offset: tq.Offset}
+	if _, err := pq.Parse(r); err != nil {
+		return nil, err
+	}
+	tq.Limit = pq.Limit
+	tq.Offset = pq.Offset
+
+	depth := r.URL.Query().Get("depth")
+	if depth != "" {
+		d, err := strconv.Atoi(depth)
+		if err != nil {
+			return nil, err
+		}
+		tq.Depth = d
+	}
+	return tq, nil
+}
+
+// UserSearchQuery filters the user listing of the admin API.
+type UserSearchQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Search string `json:"search" validate:"max=100"`
+	Status string `json:"status" validate:"omitempty,oneof=active inactive suspended banned"`
+	Role   string `json:"role" validate:"max=50"`
+}
+
+func (uq *UserSearchQuery) Parse(r *http.Request) (*UserSearchQuery, error) {
+	pq := PaginationQuery{Limit: uq.Limit, Offset: uq.Offset}
+	if _, err := pq.Parse(r); err != nil {
+		return nil, err
+	}
+	uq.Limit = pq.Limit
+	uq.Offset = pq.Offset
+
+	qs := r.URL.Query()
+	if search := qs.Get("search"); search != "" {
+		uq.Search = search
+	}
+	if status := qs.Get("status"); status != "" {
+		uq.Status = strings.ToLower(status)
+	}
+	if role := qs.Get("role"); role != "" {
+		uq.Role = role
+	}
+	return uq, nil
+}
+
+// EmailOutboxQuery filters the email outbox listing of the admin API.
+type EmailOutboxQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Status string `json:"status" validate:"omitempty,oneof=pending sending sent dead suppressed"`
+}
+
+func (eq *EmailOutboxQuery) Parse(r *http.Request) (*EmailOutboxQuery, error) {
+	pq := PaginationQuery{Limit: eq.Limit, Offset: eq.Offset}
+	if _, err := pq.Parse(r); err != nil {
+		return nil, err
+	}
+	eq.Limit = pq.Limit
+	eq.Offset = pq.Offset
+
+	if status := r.URL.Query().Get("status"); status != "" {
+		eq.Status = strings.ToLower(status)
+	}
+	return eq, nil
+}
+
+// ParseTime accepts either a date or a date-time and normalises it to
+// time.DateTime.
+func ParseTime(timeStr string) (string, error) {
+	for _, layout := range []string{time.DateTime, time.DateOnly} {
+		if t, err := time.Parse(layout, timeStr); err == nil {
+			return t.Format(time.DateTime), nil
+		}
 	}
-	return t.Format(time.DateTime)
+	return "", fmt.Errorf("%q is not a date (%s) or a date and time (%s)", timeStr, time.DateOnly, time.DateTime)
 }
@@ -10,15 +10,15 @@ import (
 )
 
 type Post struct {
-	ID        int32      `json:"id"`
-	Content   string     `json:"content"`
-	Title     string     `json:"title"`
-	UserID    int64      `json:"user_id"`
-	CreatedAt string     `json:"created_at"`
-	Version   int32      `json:"version"`
-	Tags      []string   `json:"tags,omitempty"`
-	UserName  string     `json:"username,omitempty"`
-	Comments  []Comments `json:"comments,omitempty"`
+	ID        int32            `json:"id"`
+	Content   string           `json:"content"`
+	Title     string           `json:"title"`
+	UserID    int64            `json:"user_id"`
+	CreatedAt string           `json:"created_at"`
+	Version   int32            `json:"version"`
+	Tags      []string         `json:"tags,omitempty"`
+	UserName  string           `json:"username,omitempty"`
+	Reactions *ReactionSummary `json:"reactions,omitempty"`
 }
 
 type PostWithMetadata struct {
@@ -96,27 +96,32 @@ func (s *PostStore) UpdatePost(ctx context.Context, post *Post) error {
 	return nil
 }
 
-func (s *PostStore) GetUserFeed(ctx context.Context, userID int, pfq *PaginationFeedQuery) ([]PostWithMetadata, error) {
-	query := `
+// GetUserFeed returns the home timeline for userID: their own posts plus the
+// posts of every user they follow.
+func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, pfq *PaginationFeedQuery) ([]PostWithMetadata, error) {
+	query := fmt.Sprintf(`
 		SELECT p.id, p.content, p.title, p.user_id, p.created_at, p.tags, p.version, u.username,
 		COUNT(c.id) AS comments_count
 		FROM posts p
 		LEFT JOIN comments c ON c.post_id = p.id
 		LEFT JOIN users u ON u.id = p.user_id
-		WHERE p.user_id = $1 AND (p.title ILIKE '%' || $5 || '%' OR p.content ILIKE '%' || $5 || '%') AND
-		(p.tags @> $6 OR $6 = '{}')
+		WHERE (p.user_id = $1 OR p.user_id IN (SELECT f.user_id FROM followers f WHERE f.follower_id = $1)) AND
+		(p.title ILIKE '%%' || $4 || '%%' OR p.content ILIKE '%%' || $4 || '%%') AND
+		(p.tags @> $5 OR $5 = '{}') AND
+		(NULLIF($6, '') IS NULL OR p.created_at >= NULLIF($6, '')::timestamptz) AND
+		(NULLIF($7, '') IS NULL OR p.created_at <= NULLIF($7, '')::timestamptz)
 		GROUP BY p.id, u.username
-		ORDER BY p.created_at $2
-		LIMIT $3 OFFSET $4
-	`
+		ORDER BY p.created_at %s
+		LIMIT $2 OFFSET $3
+	`, pfq.Sort)
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
-	rows, err := s.db.QueryContext(ctx, query, userID, pfq.Sort, pfq.Limit, pfq.Offset, pfq.Search, pq.Array(pfq.Tags))
+	rows, err := s.db.QueryContext(ctx, query, userID, pfq.Limit, pfq.Offset, pfq.Search, pq.Array(pfq.Tags), pfq.Since, pfq.Until)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var feeds []PostWithMetadata
+	feeds := []PostWithMetadata{}
 	for rows.Next() {
 		var feed PostWithMetadata
 		if err := rows.Scan(&feed.ID, &feed.Content, &feed.Title, &feed.UserID, &feed.CreatedAt, pq.Array(&feed.Tags), &feed.Version, &feed.UserName, &feed.CommentsCount); err != nil {
@@ -124,5 +129,20 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int, pfq *Pagination
 		}
 		feeds = append(feeds, feed)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	postIDs := make([]int32, len(feeds))
+	for i := range feeds {
+		postIDs[i] = feeds[i].ID
+	}
+	reactions, err := getReactionSummaries(ctx, s.db, postIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range feeds {
+		feeds[i].Reactions = reactions[feeds[i].ID]
+	}
 	return feeds, nil
 }
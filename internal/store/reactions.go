@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/lib/pq"
+)
+
+// ReactionTypes lists the reactions a user can leave on a post.
+var ReactionTypes = []string{"like", "love", "haha", "wow", "sad", "angry"}
+
+func IsValidReactionType(reactionType string) bool {
+	return slices.Contains(ReactionTypes, reactionType)
+}
+
+// ReactionSummary aggregates the reactions on a single post as seen by one
+// viewer.
+type ReactionSummary struct {
+	Counts      map[string]int  `json:"counts"`
+	ReactedByMe map[string]bool `json:"reacted_by_me"`
+}
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// Add records a reaction. Reacting twice with the same type is a no-op.
+func (s *ReactionStore) Add(ctx context.Context, postID int32, userID int64, reactionType string) error {
+	query := `INSERT INTO post_reactions (post_id, user_id, type) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, postID, userID, reactionType)
+	return err
+}
+
+func (s *ReactionStore) Remove(ctx context.Context, postID int32, userID int64, reactionType string) error {
+	query := `DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2 AND type = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, postID, userID, reactionType)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetSummaries returns the reaction summary of every post in postIDs from the
+// point of view of viewerID. Posts without reactions get an empty summary.
+func (s *ReactionStore) GetSummaries(ctx context.Context, postIDs []int32, viewerID int64) (map[int32]*ReactionSummary, error) {
+	return getReactionSummaries(ctx, s.db, postIDs, viewerID)
+}
+
+func getReactionSummaries(ctx context.Context, db *sql.DB, postIDs []int32, viewerID int64) (map[int32]*ReactionSummary, error) {
+	query := `
+		SELECT post_id, type, COUNT(*), BOOL_OR(user_id = $2)
+		FROM post_reactions
+		WHERE post_id = ANY($1)
+		GROUP BY post_id, type`
+
+	summaries := make(map[int32]*ReactionSummary, len(postIDs))
+	for _, id := range postIDs {
+		summaries[id] = &ReactionSummary{
+			Counts:      map[string]int{},
+			ReactedByMe: map[string]bool{},
+		}
+	}
+	if len(postIDs) == 0 {
+		return summaries, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(postIDs), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			postID       int32
+			reactionType string
+			count        int
+			mine         bool
+		)
+		if err := rows.Scan(&postID, &reactionType, &count, &mine); err != nil {
+			return nil, err
+		}
+		summary := summaries[postID]
+		summary.Counts[reactionType] = count
+		if mine {
+			summary.ReactedByMe[reactionType] = true
+		}
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// RefreshToken is one link in a rotation chain. Every token issued by
+// rotating another shares its FamilyID, so a whole login session can be
+// revoked at once.
+type RefreshToken struct {
+	ID        int64
+	UserID    int64
+	FamilyID  string
+	TokenHash string
+	Expiry    time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+type RefreshTokenStore struct {
+	db *sql.DB
+}
+
+func (s *RefreshTokenStore) Create(ctx context.Context, token *RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expiry) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, token.UserID, token.FamilyID, token.TokenHash, token.Expiry).Scan(&token.ID, &token.CreatedAt)
+}
+
+// Rotate exchanges the refresh token identified by oldHash for next, which
+// inherits the user and family of the old token. Presenting a token that was
+// already rotated revokes the entire family and returns ErrRefreshTokenReused.
+func (s *RefreshTokenStore) Rotate(ctx context.Context, oldHash string, next *RefreshToken) error {
+	reused := false
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		current, err := s.getByHashForUpdate(ctx, tx, oldHash)
+		if err != nil {
+			return err
+		}
+		if current.RevokedAt != nil || current.Expiry.Before(time.Now()) {
+			return ErrNotFound
+		}
+		if current.UsedAt != nil {
+			// the family is revoked inside the transaction, the error is
+			// reported only once it has been committed
+			reused = true
+			return s.revokeFamily(ctx, tx, current.FamilyID)
+		}
+
+		if err := s.markUsed(ctx, tx, current.ID); err != nil {
+			return err
+		}
+
+		next.UserID = current.UserID
+		next.FamilyID = current.FamilyID
+		query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expiry) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+		return tx.QueryRowContext(ctx, query, next.UserID, next.FamilyID, next.TokenHash, next.Expiry).Scan(&next.ID, &next.CreatedAt)
+	})
+	if err != nil {
+		return err
+	}
+	if reused {
+		return ErrRefreshTokenReused
+	}
+	return nil
+}
+
+// RevokeFamily revokes every token in the family of the token identified by
+// tokenHash. Unknown tokens are ignored.
+func (s *RefreshTokenStore) RevokeFamily(ctx context.Context, tokenHash string) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1) AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, tokenHash)
+	return err
+}
+
+func (s *RefreshTokenStore) getByHashForUpdate(ctx context.Context, tx *sql.Tx, tokenHash string) (*RefreshToken, error) {
+	query := `
+		SELECT id, user_id, family_id, token_hash, expiry, created_at, used_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var token RefreshToken
+	err := tx.QueryRowContext(ctx, query, tokenHash).Scan(
+		&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.Expiry, &token.CreatedAt, &token.UsedAt, &token.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *RefreshTokenStore) markUsed(ctx context.Context, tx *sql.Tx, id int64) error {
+	query := `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, id)
+	return err
+}
+
+func (s *RefreshTokenStore) revokeFamily(ctx context.Context, tx *sql.Tx, familyID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, familyID)
+	return err
+}
+
+func revokeRefreshTokensByUserID(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
@@ -3,13 +3,48 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"slices"
+
+	"github.com/lib/pq"
+)
+
+// Permissions granted to roles. Everything a regular user may do to their own
+// content needs none of them.
+const (
+	PermissionPostUpdateAny      = "post.update.any"
+	PermissionPostDeleteAny      = "post.delete.any"
+	PermissionCommentUpdateAny   = "comment.update.any"
+	PermissionCommentDeleteAny   = "comment.delete.any"
+	PermissionUserAuthEventsRead = "user.auth_events.read"
+	PermissionUserSearch         = "user.search"
+	PermissionUserSuspend        = "user.suspend"
+	PermissionUserBan            = "user.ban"
+	PermissionUserPasswordReset  = "user.password.reset"
+	PermissionUserRoleUpdate     = "user.role.update"
+	PermissionRoleManage         = "role.manage"
+	PermissionMailOutboxManage   = "mail.outbox.manage"
+	PermissionMailPreview        = "mail.template.preview"
 )
 
+var ErrUnknownPermission = errors.New("unknown permission")
+
 type Role struct {
+	ID          int64    `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Level       int      `json:"level"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+func (r *Role) HasPermission(permission string) bool {
+	return r != nil && slices.Contains(r.Permissions, permission)
+}
+
+type Permission struct {
 	ID          int64  `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
-	Level       int    `json:"level"`
 }
 
 type RoleStore struct {
@@ -17,11 +52,136 @@ type RoleStore struct {
 }
 
 func (s *RoleStore) GetByName(ctx context.Context, slug string) (*Role, error) {
-	query := `SELECT id, name, description, level FROM roles WHERE name = $1`
+	query := `SELECT id, name, COALESCE(description, ''), level FROM roles WHERE name = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
 	role := &Role{}
 	err := s.db.QueryRowContext(ctx, query, slug).Scan(&role.ID, &role.Name, &role.Description, &role.Level)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
 		return nil, err
 	}
 	return role, nil
 }
+
+// List returns every role together with the names of its permissions.
+func (s *RoleStore) List(ctx context.Context) ([]*Role, error) {
+	query := `
+		SELECT r.id, r.name, COALESCE(r.description, ''), r.level,
+			COALESCE(array_agg(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		GROUP BY r.id
+		ORDER BY r.level, r.id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.Level, pq.Array(&role.Permissions)); err != nil {
+			return nil, err
+		}
+		roles = append(roles, &role)
+	}
+	return roles, rows.Err()
+}
+
+// Create stores a new role with the given permissions. It returns ErrConflict
+// when the name is taken and ErrUnknownPermission for an undefined permission.
+func (s *RoleStore) Create(ctx context.Context, role *Role) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `INSERT INTO roles (name, description, level) VALUES ($1, $2, $3) RETURNING id`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, role.Name, role.Description, role.Level).Scan(&role.ID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+			return err
+		}
+		return s.setPermissions(ctx, tx, role.ID, role.Permissions)
+	})
+}
+
+// SetPermissions replaces the permissions of a role.
+func (s *RoleStore) SetPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		var id int64
+		err := tx.QueryRowContext(ctx, `SELECT id FROM roles WHERE id = $1 FOR UPDATE`, roleID).Scan(&id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, roleID); err != nil {
+			return err
+		}
+		return s.setPermissions(ctx, tx, roleID, permissions)
+	})
+}
+
+func (s *RoleStore) setPermissions(ctx context.Context, tx *sql.Tx, roleID int64, permissions []string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+	query := `
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT $1, id FROM permissions WHERE name = ANY($2)`
+
+	result, err := tx.ExecContext(ctx, query, roleID, pq.Array(permissions))
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected != int64(len(slices.Compact(slices.Sorted(slices.Values(permissions))))) {
+		return ErrUnknownPermission
+	}
+	return nil
+}
+
+func (s *RoleStore) ListPermissions(ctx context.Context) ([]*Permission, error) {
+	query := `SELECT id, name, description FROM permissions ORDER BY name`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []*Permission{}
+	for rows.Next() {
+		var permission Permission
+		if err := rows.Scan(&permission.ID, &permission.Name, &permission.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, &permission)
+	}
+	return permissions, rows.Err()
+}
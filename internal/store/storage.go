@@ -3,11 +3,14 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 )
 
 var (
 	QueryTimeOutDuration = 5 * time.Second
+	ErrNotFound          = errors.New("record not found")
+	ErrConflict          = errors.New("resource already exists")
 )
 
 type Storage struct {
@@ -16,30 +19,124 @@ type Storage struct {
 		GetByID(context.Context, int32) (*Post, error)
 		DeletePostByID(context.Context, int32) error
 		UpdatePost(context.Context, *Post) error
-		GetUserFeed(context.Context, int, *PaginationFeedQuery) ([]PostWithMetadata, error)
+		GetUserFeed(context.Context, int64, *PaginationFeedQuery) ([]PostWithMetadata, error)
 	}
 	Users interface {
 		Create(context.Context, *sql.Tx, *Users) error
 		GetByID(context.Context, int64) (*Users, error)
-		CreateAndInvite(ctx context.Context, user *Users, token string, invitationExp time.Duration) error
+		CreateAndInvite(ctx context.Context, user *Users, token string, invitationExp time.Duration, invitation *OutboxEmail) error
 		Activate(ctx context.Context, token string) error
 		DeleteByID(ctx context.Context, id int64) error
 		GetByEmail(ctx context.Context, email string) (*Users, error)
+		CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration, email *OutboxEmail) error
+		ResetPassword(ctx context.Context, token string, user *Users) error
+		RotateInvitation(ctx context.Context, email, token string, invitationExp, cooldown time.Duration, invitation func(*Users) (*OutboxEmail, error)) (*Users, error)
+		DeleteExpiredInvitations(ctx context.Context) (int64, error)
+		DeleteUnactivated(ctx context.Context, createdBefore time.Time) (int64, error)
+		UpdateRole(ctx context.Context, userID, roleID int64) error
+		UpdateLanguage(ctx context.Context, userID int64, language string) error
+		Search(context.Context, *UserSearchQuery) ([]*Users, error)
+		Suspend(ctx context.Context, userID int64, until time.Time, reason string) error
+		Ban(ctx context.Context, userID int64, reason string) error
+		Reactivate(ctx context.Context, userID int64) error
+		ForcePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration, email *OutboxEmail) error
 	}
 	Comments interface {
-		GetCommentsByPostID(context.Context, int32) ([]*Comments, error)
+		CountByPostID(context.Context, int32) (int, error)
+		Create(context.Context, *Comments) error
+		GetByID(context.Context, int32) (*Comments, error)
+		GetThread(ctx context.Context, postID int32, parentID *int32, tq *CommentThreadQuery) ([]*Comments, error)
+		Update(context.Context, *Comments) error
+		Delete(context.Context, int32) error
 	}
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
+		List(context.Context) ([]*Role, error)
+		Create(context.Context, *Role) error
+		SetPermissions(ctx context.Context, roleID int64, permissions []string) error
+		ListPermissions(context.Context) ([]*Permission, error)
+	}
+	Followers interface {
+		Follow(ctx context.Context, followerID, userID int64) error
+		Unfollow(ctx context.Context, followerID, userID int64) error
+		ClaimNotification(ctx context.Context, followerID, userID int64) (bool, error)
+		GetFollowers(ctx context.Context, userID int64, page *PaginationQuery) ([]*PublicUser, error)
+		GetFollowing(ctx context.Context, userID int64, page *PaginationQuery) ([]*PublicUser, error)
+		GetCounts(ctx context.Context, userID int64) (*FollowCounts, error)
+	}
+	Reactions interface {
+		Add(ctx context.Context, postID int32, userID int64, reactionType string) error
+		Remove(ctx context.Context, postID int32, userID int64, reactionType string) error
+		GetSummaries(ctx context.Context, postIDs []int32, viewerID int64) (map[int32]*ReactionSummary, error)
+	}
+	RefreshTokens interface {
+		Create(context.Context, *RefreshToken) error
+		Rotate(ctx context.Context, oldHash string, next *RefreshToken) error
+		RevokeFamily(ctx context.Context, tokenHash string) error
+	}
+	MFA interface {
+		GetTOTP(ctx context.Context, userID int64) (*TOTP, error)
+		StartTOTPEnrollment(ctx context.Context, userID int64, secret string) error
+		ConfirmTOTP(ctx context.Context, userID int64, step int64, recoveryCodeHashes []string) error
+		DisableTOTP(ctx context.Context, userID int64) error
+		UseTOTPStep(ctx context.Context, userID int64, step int64) error
+		UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error
+		CreateChallenge(ctx context.Context, userID int64, token string, exp time.Duration) error
+		AttemptChallenge(ctx context.Context, token string) (int64, error)
+		DeleteChallenge(ctx context.Context, token string) error
+	}
+	AccessTokens interface {
+		Create(context.Context, *PersonalAccessToken) error
+		Authenticate(ctx context.Context, tokenHash string) (*PersonalAccessToken, error)
+		ListByUserID(ctx context.Context, userID int64) ([]*PersonalAccessToken, error)
+		Revoke(ctx context.Context, userID, tokenID int64) error
+	}
+	LoginThrottles interface {
+		Get(ctx context.Context, key string) (*LoginThrottle, error)
+		Reserve(ctx context.Context, key string, policy ThrottlePolicy) (*LoginThrottle, bool, error)
+		Release(ctx context.Context, key string) error
+		Lock(ctx context.Context, key string, until time.Time) error
+		Reset(ctx context.Context, key string) error
+		CreateUnlock(ctx context.Context, userID int64, tokenHash string, exp time.Duration, email *OutboxEmail) error
+		Unlock(ctx context.Context, tokenHash string) (int64, error)
+	}
+	AuthEvents interface {
+		Create(context.Context, *AuthEvent) error
+		ListByUserID(ctx context.Context, userID int64, page *PaginationQuery) ([]*AuthEvent, error)
+	}
+	EmailOutbox interface {
+		Enqueue(context.Context, *OutboxEmail) error
+		Claim(ctx context.Context, limit int, lease time.Duration) ([]*OutboxEmail, error)
+		MarkSent(context.Context, *OutboxEmail) error
+		Reschedule(ctx context.Context, email *OutboxEmail, lastError string, at time.Time) error
+		DeadLetter(ctx context.Context, email *OutboxEmail, lastError string) error
+		Retry(ctx context.Context, id int64) error
+		GetByID(ctx context.Context, id int64) (*OutboxEmail, error)
+		List(context.Context, *EmailOutboxQuery) ([]*OutboxEmail, error)
+		Suppress(ctx context.Context, email *OutboxEmail, reason string) error
+	}
+	NotificationSettings interface {
+		Get(ctx context.Context, userID int64) (*NotificationSettings, error)
+		Update(context.Context, *NotificationSettings) error
+		Unsubscribe(ctx context.Context, userID int64, kind string) error
 	}
 }
 
 func NewPostgresStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:    &PostStore{db: db},
-		Users:    &UsersStorage{db: db},
-		Comments: &CommentsStore{db: db},
-		Roles:    &RoleStore{db: db},
+		Posts:                &PostStore{db: db},
+		Users:                &UsersStorage{db: db},
+		Comments:             &CommentsStore{db: db},
+		Roles:                &RoleStore{db: db},
+		Followers:            &FollowerStore{db: db},
+		Reactions:            &ReactionStore{db: db},
+		RefreshTokens:        &RefreshTokenStore{db: db},
+		MFA:                  &MFAStore{db: db},
+		AccessTokens:         &AccessTokenStore{db: db},
+		LoginThrottles:       &LoginThrottleStore{db: db},
+		AuthEvents:           &AuthEventStore{db: db},
+		EmailOutbox:          &EmailOutboxStore{db: db},
+		NotificationSettings: &NotificationSettingsStore{db: db},
 	}
 }
 
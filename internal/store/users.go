@@ -5,7 +5,9 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -20,6 +22,18 @@ type Users struct {
 	IsActive  bool     `json:"is_active"`
 	RoleID    int64    `json:"role_id"`
 	Role      Role     `json:"role"`
+	// Language is the preferred language of the user, a BCP 47 tag such as
+	// "en" or "es-MX". Emails are sent in it when a translation exists.
+	Language string `json:"language"`
+
+	SuspendedUntil   *time.Time `json:"suspended_until,omitempty"`
+	BannedAt         *time.Time `json:"banned_at,omitempty"`
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
+}
+
+// Suspended reports whether the account is banned or serving a suspension.
+func (u *Users) Suspended(now time.Time) bool {
+	return u.BannedAt != nil || (u.SuspendedUntil != nil && now.Before(*u.SuspendedUntil))
 }
 
 type password struct {
@@ -40,17 +54,30 @@ func (p *password) Compare(text string) error {
 	return bcrypt.CompareHashAndPassword(p.hash, []byte(text))
 }
 
+// dummyPasswordHash is what CompareDummyPassword checks against, hashed on
+// first use with the cost of real passwords.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// CompareDummyPassword takes as long as checking a real password. Logins for
+// unknown emails call it so they cannot be told apart by their timing.
+func CompareDummyPassword(text string) {
+	bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(text))
+}
+
 type UsersStorage struct {
 	db *sql.DB
 }
 
 func (s *UsersStorage) Create(ctx context.Context, tx *sql.Tx, user *Users) error {
-	query := `INSERT INTO users (username, email, password,role_id, created_at) 
-			VALUES ($1, $2, $3, (SELECT id FROM roles WHERE name = $4), NOW()) RETURNING id, created_at`
+	query := `INSERT INTO users (username, email, password,role_id, language, created_at) 
+			VALUES ($1, $2, $3, (SELECT id FROM roles WHERE name = $4), COALESCE(NULLIF($5, ''), 'en'), NOW()) RETURNING id, language, created_at`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
-	err := tx.QueryRowContext(ctx, query, user.Username, user.Email, user.Password.hash, user.Role.Name).Scan(&user.ID, &user.CreatedAt)
+	err := tx.QueryRowContext(ctx, query, user.Username, user.Email, user.Password.hash, user.Role.Name, user.Language).Scan(&user.ID, &user.Language, &user.CreatedAt)
 	return err
 }
 func (s *UsersStorage) updateUser(ctx context.Context, tx *sql.Tx, user *Users) error {
@@ -63,24 +90,28 @@ func (s *UsersStorage) updateUser(ctx context.Context, tx *sql.Tx, user *Users)
 
 func (s *UsersStorage) GetByID(ctx context.Context, id int64) (*Users, error) {
 	query := `
-		SELECT users.id, username, email, created_at, roles.*
+		SELECT users.id, username, email, created_at, roles.id, roles.description, roles.name, roles.level,
+			suspended_until, banned_at, suspension_reason, language
 		FROM users 
 		JOIN roles ON (users.role_id = roles.id)
 		WHERE users.id = $1 AND is_active = true`
 	row := s.db.QueryRowContext(ctx, query, id)
 
 	var user Users
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.Role.ID, &user.Role.Description, &user.Role.Name, &user.Role.Level)
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.Role.ID, &user.Role.Description, &user.Role.Name, &user.Role.Level,
+		&user.SuspendedUntil, &user.BannedAt, &user.SuspensionReason, &user.Language)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user with ID %d not found", id)
+			return nil, ErrNotFound
 		}
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (s *UsersStorage) CreateAndInvite(ctx context.Context, user *Users, token string, invitationExp time.Duration) error {
+// CreateAndInvite creates an inactive user together with its invitation, and
+// queues the invitation email in the same transaction.
+func (s *UsersStorage) CreateAndInvite(ctx context.Context, user *Users, token string, invitationExp time.Duration, invitation *OutboxEmail) error {
 	return withTx(ctx, s.db, func(tx *sql.Tx) error {
 		if err := s.Create(ctx, tx, user); err != nil {
 			return err
@@ -90,7 +121,8 @@ func (s *UsersStorage) CreateAndInvite(ctx context.Context, user *Users, token s
 		if err != nil {
 			return err
 		}
-		return nil
+		invitation.UserID = user.ID
+		return enqueueEmail(ctx, tx, invitation)
 	})
 }
 
@@ -170,17 +202,358 @@ func (s *UsersStorage) deleteUserByID(ctx context.Context, tx *sql.Tx, id int64)
 	return err
 }
 
+func (s *UsersStorage) UpdateRole(ctx context.Context, userID, roleID int64) error {
+	query := `UPDATE users SET role_id = $2 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID, roleID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdateLanguage changes the language the user gets emails in.
+func (s *UsersStorage) UpdateLanguage(ctx context.Context, userID int64, language string) error {
+	query := `UPDATE users SET language = $2 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID, language)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 func (s *UsersStorage) GetByEmail(ctx context.Context, email string) (*Users, error) {
-	query := `SELECT id, username, email, created_at FROM users WHERE email = $1 AND is_active = true`
+	query := `
+		SELECT id, username, email, password, created_at, suspended_until, banned_at, suspension_reason, language
+		FROM users WHERE email = $1 AND is_active = true`
 	row := s.db.QueryRowContext(ctx, query, email)
 
 	var user Users
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt)
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password.hash, &user.CreatedAt, &user.SuspendedUntil, &user.BannedAt, &user.SuspensionReason, &user.Language)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CreatePasswordReset stores a reset token for userID and queues the email
+// that carries it in the same transaction.
+func (s *UsersStorage) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration, email *OutboxEmail) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.createPasswordReset(ctx, tx, userID, token, exp); err != nil {
+			return err
+		}
+		return enqueueEmail(ctx, tx, email)
+	})
+}
+
+func (s *UsersStorage) createPasswordReset(ctx context.Context, tx *sql.Tx, userID int64, token string, exp time.Duration) error {
+	query := `INSERT INTO password_resets (user_id, token, expiry) VALUES ($1, $2, $3)`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, userID, token, time.Now().Add(exp))
+	return err
+}
+
+// ResetPassword stores user.Password for the owner of the reset token, then
+// drops every outstanding reset token and refresh token of that user so
+// existing sessions cannot outlive the old password.
+func (s *UsersStorage) ResetPassword(ctx context.Context, token string, user *Users) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		owner, err := s.getUserByPasswordResetToken(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+		user.ID = owner.ID
+		if err := s.updatePassword(ctx, tx, user); err != nil {
+			return err
+		}
+		if err := s.deletePasswordResetsByUserID(ctx, tx, user.ID); err != nil {
+			return err
+		}
+		return revokeRefreshTokensByUserID(ctx, tx, user.ID)
+	})
+}
+
+func (s *UsersStorage) getUserByPasswordResetToken(ctx context.Context, tx *sql.Tx, token string) (*Users, error) {
+	query := `SELECT u.id, u.username, u.email, u.created_at, u.is_active
+			FROM users u
+			JOIN password_resets pr ON u.id = pr.user_id
+			WHERE pr.token = $1 AND pr.expiry > NOW()`
+
+	hashToken := sha256.Sum256([]byte(token))
+	hashedToken := hex.EncodeToString(hashToken[:])
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	row := tx.QueryRowContext(ctx, query, hashedToken)
+
+	var user Users
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *UsersStorage) updatePassword(ctx context.Context, tx *sql.Tx, user *Users) error {
+	query := `UPDATE users SET password = $1 WHERE id = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, user.Password.hash, user.ID)
+	return err
+}
+
+func (s *UsersStorage) deletePasswordResetsByUserID(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM password_resets WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
+
+// ErrInvitationCooldown is returned by RotateInvitation when the current
+// invitation was issued too recently to be replaced.
+var ErrInvitationCooldown = errors.New("invitation issued too recently")
+
+// RotateInvitation replaces the invitation of the not yet activated account
+// registered with email and queues the email built by invitation for it, in
+// one transaction. It refuses with ErrInvitationCooldown while the current
+// invitation is younger than cooldown, so the account cannot be flooded with
+// activation emails. The account is returned as soon as it is found, also
+// when the rotation fails afterwards, so callers can tell whose it was.
+func (s *UsersStorage) RotateInvitation(ctx context.Context, email, token string, invitationExp, cooldown time.Duration, invitation func(*Users) (*OutboxEmail, error)) (*Users, error) {
+	var user *Users
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		var err error
+		user, err = s.getInactiveByEmail(ctx, tx, email)
+		if err != nil {
+			return err
+		}
+		recent, err := s.hasInvitationSince(ctx, tx, user.ID, time.Now().Add(invitationExp-cooldown))
+		if err != nil {
+			return err
+		}
+		if recent {
+			return ErrInvitationCooldown
+		}
+		if err := s.DeleteInvitationByUserID(ctx, tx, user.ID); err != nil {
+			return err
+		}
+		if err := s.createUserInvitation(ctx, tx, token, invitationExp, user.ID); err != nil {
+			return err
+		}
+		msg, err := invitation(user)
+		if err != nil {
+			return err
+		}
+		msg.UserID = user.ID
+		return enqueueEmail(ctx, tx, msg)
+	})
+	return user, err
+}
+
+// hasInvitationSince reports whether userID holds an invitation expiring
+// after expiry. Invitations all last as long, so that tells when the newest
+// one was issued.
+func (s *UsersStorage) hasInvitationSince(ctx context.Context, tx *sql.Tx, userID int64, expiry time.Time) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM user_invitations WHERE user_id = $1 AND expiry > $2)`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var exists bool
+	err := tx.QueryRowContext(ctx, query, userID, expiry).Scan(&exists)
+	return exists, err
+}
+
+func (s *UsersStorage) getInactiveByEmail(ctx context.Context, tx *sql.Tx, email string) (*Users, error) {
+	query := `SELECT id, username, email, created_at, is_active, language FROM users WHERE email = $1 AND is_active = false FOR UPDATE`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var user Users
+	err := tx.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive, &user.Language)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user with Email %d not found", email)
+			return nil, ErrNotFound
 		}
 		return nil, err
 	}
 	return &user, nil
 }
+
+func (s *UsersStorage) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	query := `DELETE FROM user_invitations WHERE expiry <= NOW()`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteUnactivated removes accounts that were never activated, were created
+// before the cutoff and have no pending invitation left.
+func (s *UsersStorage) DeleteUnactivated(ctx context.Context, createdBefore time.Time) (int64, error) {
+	query := `
+		DELETE FROM users u
+		WHERE u.is_active = false AND u.created_at < $1
+		AND NOT EXISTS (SELECT 1 FROM user_invitations ui WHERE ui.user_id = u.id AND ui.expiry > NOW())`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, createdBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Search lists users of any state, newest first, for the admin API.
+func (s *UsersStorage) Search(ctx context.Context, uq *UserSearchQuery) ([]*Users, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.created_at, u.is_active,
+			r.id, COALESCE(r.description, ''), r.name, r.level,
+			u.suspended_until, u.banned_at, u.suspension_reason
+		FROM users u
+		JOIN roles r ON r.id = u.role_id
+		WHERE ($1 = '' OR u.username ILIKE '%' || $1 || '%' OR u.email ILIKE '%' || $1 || '%')
+			AND ($2 = '' OR r.name = $2)
+			AND (CASE $3
+				WHEN 'active' THEN u.is_active AND u.banned_at IS NULL AND (u.suspended_until IS NULL OR u.suspended_until <= NOW())
+				WHEN 'inactive' THEN NOT u.is_active
+				WHEN 'suspended' THEN u.banned_at IS NULL AND u.suspended_until > NOW()
+				WHEN 'banned' THEN u.banned_at IS NOT NULL
+				ELSE TRUE
+			END)
+		ORDER BY u.created_at DESC, u.id DESC
+		LIMIT $4 OFFSET $5`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, uq.Search, uq.Role, uq.Status, uq.Limit, uq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*Users{}
+	for rows.Next() {
+		var user Users
+		err := rows.Scan(
+			&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive,
+			&user.Role.ID, &user.Role.Description, &user.Role.Name, &user.Role.Level,
+			&user.SuspendedUntil, &user.BannedAt, &user.SuspensionReason,
+		)
+		if err != nil {
+			return nil, err
+		}
+		user.RoleID = user.Role.ID
+		users = append(users, &user)
+	}
+	return users, rows.Err()
+}
+
+// Suspend blocks userID until the given time and ends all of its sessions.
+func (s *UsersStorage) Suspend(ctx context.Context, userID int64, until time.Time, reason string) error {
+	query := `UPDATE users SET suspended_until = $2, suspension_reason = $3 WHERE id = $1`
+	return s.restrict(ctx, userID, query, until, reason)
+}
+
+// Ban blocks userID permanently and ends all of its sessions.
+func (s *UsersStorage) Ban(ctx context.Context, userID int64, reason string) error {
+	query := `UPDATE users SET banned_at = NOW(), suspended_until = NULL, suspension_reason = $2 WHERE id = $1`
+	return s.restrict(ctx, userID, query, reason)
+}
+
+func (s *UsersStorage) restrict(ctx context.Context, userID int64, query string, args ...any) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		result, err := tx.ExecContext(ctx, query, append([]any{userID}, args...)...)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrNotFound
+		}
+		return revokeRefreshTokensByUserID(ctx, tx, userID)
+	})
+}
+
+// Reactivate lifts a suspension or a ban.
+func (s *UsersStorage) Reactivate(ctx context.Context, userID int64) error {
+	query := `UPDATE users SET suspended_until = NULL, banned_at = NULL, suspension_reason = '' WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ForcePasswordReset clears the password of userID, ends its sessions and
+// stores a reset token, so the account stays unusable until the owner picks
+// a new password. The email carrying the token is queued in the same
+// transaction.
+func (s *UsersStorage) ForcePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration, email *OutboxEmail) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.updatePassword(ctx, tx, &Users{ID: userID, Password: password{hash: []byte{}}}); err != nil {
+			return err
+		}
+		if err := s.deletePasswordResetsByUserID(ctx, tx, userID); err != nil {
+			return err
+		}
+		if err := s.createPasswordReset(ctx, tx, userID, token, exp); err != nil {
+			return err
+		}
+		if err := revokeRefreshTokensByUserID(ctx, tx, userID); err != nil {
+			return err
+		}
+		return enqueueEmail(ctx, tx, email)
+	})
+}